@@ -0,0 +1,150 @@
+// Package alert evaluates alert rules on every probe result and sends firing and resolved
+// notifications, for deployments without Alertmanager. State is kept in memory, so alerts
+// that were firing before a restart fire again once their condition is seen.
+package alert
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/logging"
+	"github.com/dniminenn/mailmetrix/results"
+)
+
+var logger = logging.New("alert")
+
+// notifyTimeout bounds how long a single notification may take to deliver.
+const notifyTimeout = 30 * time.Second
+
+// state is the alert state of one rule for one server.
+type state struct {
+	// pendingSince is when the condition was first seen holding, zero while it does not.
+	pendingSince time.Time
+	firing       bool
+	lastSent     time.Time
+	summary      string
+	// failures counts consecutive failed sessions.
+	failures int
+}
+
+type stateKey struct {
+	rule, kind, server string
+}
+
+// Manager is a results.Observer that tracks the state of every rule and notifies on
+// transitions. A firing alert is only sent again after the repeat interval.
+type Manager struct {
+	rules     []rule
+	notifiers []Notifier
+	repeat    time.Duration
+	// now returns the current time; tests replace it to step through hold and repeat intervals.
+	now func() time.Time
+
+	mu     sync.Mutex
+	states map[stateKey]*state
+}
+
+// NewManager returns a Manager for the configured rules and notifiers.
+func NewManager(cfg config.AlertingConfig) *Manager {
+	m := &Manager{
+		repeat: time.Duration(cfg.RepeatIntervalMinutes) * time.Minute,
+		states: make(map[stateKey]*state),
+		now:    time.Now,
+	}
+	for _, r := range cfg.Rules {
+		m.rules = append(m.rules, newRule(r))
+	}
+	for _, n := range cfg.Notifiers {
+		m.notifiers = append(m.notifiers, newNotifier(n))
+	}
+	return m
+}
+
+// Observe evaluates every rule matching the result.
+func (m *Manager) Observe(r results.Result) {
+	entry := r.Entry()
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rl := range m.rules {
+		if !rl.matches(entry) {
+			continue
+		}
+		key := stateKey{rule: rl.cfg.Name, kind: entry.Kind, server: entry.Server}
+		s, ok := m.states[key]
+		if !ok {
+			s = &state{}
+			m.states[key] = s
+		}
+		m.evaluate(rl, key, s, entry, now)
+	}
+}
+
+func (m *Manager) evaluate(rl rule, key stateKey, s *state, entry results.Entry, now time.Time) {
+	active, summary, known := rl.check(entry, s)
+	if !known {
+		return
+	}
+
+	if !active {
+		since := s.pendingSince
+		s.pendingSince = time.Time{}
+		if s.firing {
+			s.firing = false
+			alertsFiring.WithLabelValues(key.rule, key.kind, key.server).Set(0)
+			m.notify(Notification{
+				Status:  StatusResolved,
+				Rule:    key.rule,
+				Kind:    key.kind,
+				Server:  key.server,
+				Summary: s.summary,
+				Since:   since,
+				Time:    now,
+			})
+		}
+		return
+	}
+
+	if s.pendingSince.IsZero() {
+		s.pendingSince = now
+	}
+	s.summary = summary
+	if !s.firing && now.Sub(s.pendingSince) < rl.hold {
+		return
+	}
+	if s.firing && now.Sub(s.lastSent) < m.repeat {
+		return
+	}
+	s.firing = true
+	s.lastSent = now
+	alertsFiring.WithLabelValues(key.rule, key.kind, key.server).Set(1)
+	m.notify(Notification{
+		Status:  StatusFiring,
+		Rule:    key.rule,
+		Kind:    key.kind,
+		Server:  key.server,
+		Summary: summary,
+		Since:   s.pendingSince,
+		Time:    now,
+	})
+}
+
+// notify sends n to every notifier in the background.
+func (m *Manager) notify(n Notification) {
+	logger.Info("Alert "+n.Status, "rule", n.Rule, "type", n.Kind, "server", n.Server, "summary", n.Summary)
+	for _, notifier := range m.notifiers {
+		go func(notifier Notifier) {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			if err := notifier.Notify(ctx, n); err != nil {
+				logger.Error("Sending notification failed", "rule", n.Rule, "notifier", notifier.Name(), "error", err)
+				alertNotifications.WithLabelValues(notifier.Name(), "failed").Inc()
+				return
+			}
+			alertNotifications.WithLabelValues(notifier.Name(), "sent").Inc()
+		}(notifier)
+	}
+}
@@ -0,0 +1,199 @@
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/results"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// sink is a local HTTP receiver for webhook and Slack notifications.
+type sink struct {
+	*httptest.Server
+	bodies chan []byte
+}
+
+func newSink(t *testing.T) *sink {
+	s := &sink{bodies: make(chan []byte, 10)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s request with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		s.bodies <- body
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// next returns the next notification received.
+func (s *sink) next(t *testing.T) []byte {
+	t.Helper()
+	select {
+	case body := <-s.bodies:
+		return body
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification received")
+		return nil
+	}
+}
+
+// notification decodes the next webhook notification.
+func (s *sink) notification(t *testing.T) Notification {
+	t.Helper()
+	var n Notification
+	if err := json.Unmarshal(s.next(t), &n); err != nil {
+		t.Fatalf("invalid notification: %v", err)
+	}
+	return n
+}
+
+// none checks that no notification arrives.
+func (s *sink) none(t *testing.T) {
+	t.Helper()
+	select {
+	case body := <-s.bodies:
+		t.Fatalf("unexpected notification: %s", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// clock is a fake time source for the manager.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newManager(t *testing.T, cfg config.AlertingConfig, notifierType string) (*Manager, *sink, *clock) {
+	s := newSink(t)
+	cfg.Notifiers = []config.AlertNotifierConfig{{Name: "test", Type: notifierType, URL: s.URL}}
+	m := NewManager(cfg)
+	c := &clock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	m.now = func() time.Time { return c.now }
+	return m, s, c
+}
+
+func result(server string, err error) results.Result {
+	return results.Result{Kind: "imap", Server: server, Time: time.Now(), Err: err}
+}
+
+func TestConsecutiveFailures(t *testing.T) {
+	m, s, _ := newManager(t, config.AlertingConfig{
+		Rules: []config.AlertRuleConfig{{Name: "imap-down", Type: "consecutive_failures", Kind: "imap", Failures: 2}},
+	}, "webhook")
+	failed := errors.New("login failed")
+
+	m.Observe(result("mail.example.com", failed))
+	s.none(t)
+
+	m.Observe(result("mail.example.com", failed))
+	n := s.notification(t)
+	if n.Status != StatusFiring || n.Rule != "imap-down" || n.Kind != "imap" || n.Server != "mail.example.com" {
+		t.Errorf("firing notification = %+v", n)
+	}
+	if want := "2 consecutive failed sessions, last: login failed"; n.Summary != want {
+		t.Errorf("summary = %q, want %q", n.Summary, want)
+	}
+	if v := testutil.ToFloat64(alertsFiring.WithLabelValues("imap-down", "imap", "mail.example.com")); v != 1 {
+		t.Errorf("alerts firing = %v, want 1", v)
+	}
+
+	// Results of another server or kind do not affect the alert.
+	m.Observe(result("other.example.com", nil))
+	m.Observe(results.Result{Kind: "smtp", Server: "mail.example.com", Err: failed})
+	s.none(t)
+
+	m.Observe(result("mail.example.com", nil))
+	n = s.notification(t)
+	if n.Status != StatusResolved || n.Summary != "2 consecutive failed sessions, last: login failed" {
+		t.Errorf("resolved notification = %+v", n)
+	}
+	if v := testutil.ToFloat64(alertsFiring.WithLabelValues("imap-down", "imap", "mail.example.com")); v != 0 {
+		t.Errorf("alerts firing = %v, want 0", v)
+	}
+
+	m.Observe(result("mail.example.com", nil))
+	m.Observe(result("mail.example.com", failed))
+	s.none(t)
+}
+
+func TestForMinutesHold(t *testing.T) {
+	m, s, c := newManager(t, config.AlertingConfig{
+		Rules: []config.AlertRuleConfig{{Name: "imap-down", Type: "consecutive_failures", Failures: 1, ForMinutes: 5}},
+	}, "webhook")
+	failed := errors.New("connection refused")
+	start := c.now
+
+	m.Observe(result("mail.example.com", failed))
+	c.advance(4 * time.Minute)
+	m.Observe(result("mail.example.com", failed))
+	s.none(t)
+
+	// A success before the hold ends resets it.
+	m.Observe(result("mail.example.com", nil))
+	c.advance(2 * time.Minute)
+	m.Observe(result("mail.example.com", failed))
+	s.none(t)
+
+	restart := c.now
+	c.advance(5 * time.Minute)
+	m.Observe(result("mail.example.com", failed))
+	n := s.notification(t)
+	if n.Status != StatusFiring || !n.Since.Equal(restart) || !n.Time.Equal(c.now) {
+		t.Errorf("notification = %+v, want firing since %s", n, restart)
+	}
+	if n.Since.Equal(start) {
+		t.Error("hold was not reset by the successful session")
+	}
+}
+
+func TestRepeatInterval(t *testing.T) {
+	m, s, c := newManager(t, config.AlertingConfig{
+		RepeatIntervalMinutes: 60,
+		Rules:                 []config.AlertRuleConfig{{Name: "imap-down", Type: "consecutive_failures", Failures: 1}},
+	}, "webhook")
+	failed := errors.New("timeout")
+
+	m.Observe(result("mail.example.com", failed))
+	if n := s.notification(t); n.Status != StatusFiring {
+		t.Fatalf("notification = %+v, want firing", n)
+	}
+
+	for i := 0; i < 3; i++ {
+		c.advance(15 * time.Minute)
+		m.Observe(result("mail.example.com", failed))
+	}
+	s.none(t)
+
+	c.advance(15 * time.Minute)
+	m.Observe(result("mail.example.com", failed))
+	if n := s.notification(t); n.Status != StatusFiring || n.Summary != "5 consecutive failed sessions, last: timeout" {
+		t.Errorf("repeated notification = %+v", n)
+	}
+}
+
+func TestSlackPayload(t *testing.T) {
+	m, s, _ := newManager(t, config.AlertingConfig{
+		Rules: []config.AlertRuleConfig{{Name: "imap-down", Type: "consecutive_failures", Failures: 1}},
+	}, "slack")
+
+	m.Observe(result("mail.example.com", errors.New("login failed")))
+	var payload map[string]any
+	if err := json.Unmarshal(s.next(t), &payload); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	want := map[string]any{"text": "*[FIRING] imap-down: imap mail.example.com*\n1 consecutive failed sessions, last: login failed"}
+	if len(payload) != len(want) || payload["text"] != want["text"] {
+		t.Errorf("payload = %v, want %v", payload, want)
+	}
+}
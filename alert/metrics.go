@@ -0,0 +1,42 @@
+package alert
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	alertsFiring = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "alerts_firing",
+			Help:      "Whether the alert rule is firing for the server (1) or not (0)",
+			Namespace: "mailmetrix",
+		},
+		[]string{"rule", "kind", "server"},
+	)
+	alertNotifications = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "alert_notifications_total",
+			Help:      "Total number of alert notifications by notifier and outcome (sent or failed)",
+			Namespace: "mailmetrix",
+		},
+		[]string{"notifier", "status"},
+	)
+)
+
+func init() {
+	metrics := []prometheus.Collector{
+		alertsFiring,
+		alertNotifications,
+	}
+
+	for _, metric := range metrics {
+		if err := prometheus.Register(metric); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				prometheus.Unregister(are.ExistingCollector)
+				prometheus.MustRegister(metric)
+			} else {
+				logger.Error("Error registering metric", "error", err)
+			}
+		}
+	}
+}
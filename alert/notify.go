@@ -0,0 +1,178 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+)
+
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Notification is a firing or resolved alert, sent as is by the webhook notifier.
+type Notification struct {
+	Status  string `json:"status"`
+	Rule    string `json:"rule"`
+	Kind    string `json:"kind"`
+	Server  string `json:"server"`
+	Summary string `json:"summary"`
+	// Since is when the alert condition was first seen.
+	Since time.Time `json:"since"`
+	Time  time.Time `json:"time"`
+}
+
+func (n Notification) title() string {
+	return fmt.Sprintf("[%s] %s: %s %s", strings.ToUpper(n.Status), n.Rule, n.Kind, n.Server)
+}
+
+// Notifier delivers notifications to one destination.
+type Notifier interface {
+	Notify(context.Context, Notification) error
+	Name() string
+}
+
+func newNotifier(cfg config.AlertNotifierConfig) Notifier {
+	switch cfg.Type {
+	case "slack":
+		return &slackNotifier{cfg: cfg, client: &http.Client{}}
+	case "email":
+		return &emailNotifier{cfg: cfg}
+	default:
+		return &webhookNotifier{cfg: cfg, client: &http.Client{}}
+	}
+}
+
+// webhookNotifier posts the notification as JSON.
+type webhookNotifier struct {
+	cfg    config.AlertNotifierConfig
+	client *http.Client
+}
+
+func (w *webhookNotifier) Name() string {
+	return w.cfg.Name
+}
+
+func (w *webhookNotifier) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, w.client, w.cfg.URL, n)
+}
+
+// slackNotifier posts to a Slack or Mattermost incoming webhook.
+type slackNotifier struct {
+	cfg    config.AlertNotifierConfig
+	client *http.Client
+}
+
+func (s *slackNotifier) Name() string {
+	return s.cfg.Name
+}
+
+func (s *slackNotifier) Notify(ctx context.Context, n Notification) error {
+	text := fmt.Sprintf("*%s*\n%s", n.title(), n.Summary)
+	return postJSON(ctx, s.client, s.cfg.URL, map[string]string{"text": text})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// emailNotifier sends a plain-text message through an SMTP submission server.
+type emailNotifier struct {
+	cfg config.AlertNotifierConfig
+}
+
+func (e *emailNotifier) Name() string {
+	return e.cfg.Name
+}
+
+func (e *emailNotifier) Notify(ctx context.Context, n Notification) error {
+	address := net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to read greeting: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: e.cfg.Host}); err != nil {
+			return fmt.Errorf("starttls failed: %w", err)
+		}
+	}
+	if e.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)); err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+	if err := c.Mail(e.cfg.From); err != nil {
+		return fmt.Errorf("MAIL FROM failed: %w", err)
+	}
+	for _, to := range e.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("RCPT TO %s failed: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("DATA failed: %w", err)
+	}
+	if _, err := w.Write(e.message(n)); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message rejected: %w", err)
+	}
+	return c.Quit()
+}
+
+func (e *emailNotifier) message(n Notification) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: [mailmetrix] %s\r\n", n.title())
+	fmt.Fprintf(&b, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&b, "%s\r\n\r\n", n.Summary)
+	fmt.Fprintf(&b, "Rule: %s\r\nKind: %s\r\nServer: %s\r\nSince: %s\r\n",
+		n.Rule, n.Kind, n.Server, n.Since.Format(time.RFC3339))
+	return b.Bytes()
+}
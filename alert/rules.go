@@ -0,0 +1,65 @@
+package alert
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/results"
+)
+
+type rule struct {
+	cfg  config.AlertRuleConfig
+	hold time.Duration
+}
+
+func newRule(cfg config.AlertRuleConfig) rule {
+	return rule{cfg: cfg, hold: time.Duration(cfg.ForMinutes) * time.Minute}
+}
+
+func (r rule) matches(e results.Entry) bool {
+	return (r.cfg.Kind == "" || r.cfg.Kind == e.Kind) && (r.cfg.Server == "" || r.cfg.Server == e.Server)
+}
+
+// check reports whether the alert condition holds for the result, with a summary of what
+// was seen. known is false when the result does not tell, such as a step_duration rule on
+// a session that failed before reaching the step, and the state is left as it is.
+func (r rule) check(e results.Entry, s *state) (active bool, summary string, known bool) {
+	switch r.cfg.Type {
+	case "consecutive_failures":
+		if e.Success {
+			s.failures = 0
+			return false, "", true
+		}
+		s.failures++
+		return s.failures >= r.cfg.Failures,
+			fmt.Sprintf("%d consecutive failed sessions, last: %s", s.failures, e.Error), true
+
+	case "step_duration":
+		var longest float64
+		var seen bool
+		for _, step := range e.Steps {
+			// Steps of a tester probing every address carry the address, as in "authentication [192.0.2.1]".
+			if step.Error != "" || (step.Name != r.cfg.Step && !strings.HasPrefix(step.Name, r.cfg.Step+" [")) {
+				continue
+			}
+			seen = true
+			longest = max(longest, step.Duration)
+		}
+		if !seen {
+			return false, "", false
+		}
+		return longest > r.cfg.ThresholdSeconds,
+			fmt.Sprintf("%s took %.2fs, above %.2fs", r.cfg.Step, longest, r.cfg.ThresholdSeconds), true
+
+	case "cert_expiry":
+		if e.CertExpiry == nil {
+			return false, "", false
+		}
+		left := time.Until(*e.CertExpiry)
+		return left < time.Duration(r.cfg.Days)*24*time.Hour,
+			fmt.Sprintf("certificate expires %s (in %.1f days)", e.CertExpiry.Format(time.RFC3339), left.Hours()/24), true
+	}
+	return false, "", false
+}
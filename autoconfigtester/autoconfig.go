@@ -0,0 +1,154 @@
+package autoconfigtester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/dnstester"
+	"github.com/dniminenn/mailmetrix/errclass"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Tester checks the client configuration a domain publishes through Mozilla autoconfig,
+// Microsoft Autodiscover and RFC 6186 SRV records, and compares the advertised servers
+// with the hosts that are being monitored.
+type Tester struct {
+	cfg      config.AutoconfigDomainConfig
+	email    string
+	expected map[string]map[string]bool
+	client   *http.Client
+	resolver *net.Resolver
+}
+
+func (t *Tester) GetName() string {
+	return t.cfg.Domain
+}
+
+// NewTester creates a tester for the domain. imapHosts are the hosts from imap.servers;
+// resolverAddress is used for the SRV lookups.
+func NewTester(cfg config.AutoconfigDomainConfig, imapHosts []string, resolverAddress string) *Tester {
+	email := cfg.Email
+	if email == "" {
+		email = "postmaster@" + cfg.Domain
+	}
+
+	expected := map[string]map[string]bool{
+		"imap": {},
+		"smtp": {},
+	}
+	for _, host := range imapHosts {
+		expected["imap"][normalizeHost(host)] = true
+	}
+	for _, host := range cfg.SubmissionHosts {
+		expected["smtp"][normalizeHost(host)] = true
+	}
+
+	return &Tester{
+		cfg:      cfg,
+		email:    email,
+		expected: expected,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		resolver: dnstester.NewResolver(resolverAddress),
+	}
+}
+
+// If we don't clean up stale metrics, Prometheus will keep reporting the last value indefinitely.
+func (t *Tester) handleFailure(source string, err error) {
+	t.log().Error("Autoconfig failed", "source", source, "error_class", errclass.Classify(err), "error", err)
+	autoconfigFailures.WithLabelValues(t.cfg.Domain, source).Inc()
+	autoconfigValid.WithLabelValues(t.cfg.Domain, source).Set(0)
+	autoconfigLookupTime.WithLabelValues(t.cfg.Domain, source).Set(math.NaN())
+	autoconfigMismatches.WithLabelValues(t.cfg.Domain, source).Set(math.NaN())
+	autoconfigEndpointMatch.DeletePartialMatch(prometheus.Labels{"domain": t.cfg.Domain, "source": source})
+}
+
+// RunSession checks every source and returns the joined errors of those that failed.
+func (t *Tester) RunSession(ctx context.Context) error {
+	sources := []struct {
+		name  string
+		fetch func(context.Context) ([]endpoint, error)
+	}{
+		{"mozilla", t.fetchMozilla},
+		{"autodiscover", t.fetchAutodiscover},
+		{"srv", t.lookupSRV},
+	}
+
+	var errs []error
+	for _, source := range sources {
+		start := time.Now()
+		endpoints, err := source.fetch(ctx)
+		if err == nil {
+			err = validate(endpoints)
+		}
+		if err != nil {
+			t.handleFailure(source.name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", source.name, err))
+			continue
+		}
+		autoconfigLookupTime.WithLabelValues(t.cfg.Domain, source.name).Set(time.Since(start).Seconds())
+		autoconfigValid.WithLabelValues(t.cfg.Domain, source.name).Set(1)
+		t.compare(source.name, endpoints)
+	}
+	return errors.Join(errs...)
+}
+
+// validate requires at least one IMAP and one SMTP endpoint with a host and port.
+func validate(endpoints []endpoint) error {
+	found := map[string]bool{}
+	for _, e := range endpoints {
+		if e.host == "" || e.port <= 0 || e.port > 65535 {
+			return fmt.Errorf("invalid %s endpoint %q port %d", e.protocol, e.host, e.port)
+		}
+		found[e.protocol] = true
+	}
+	if !found["imap"] {
+		return fmt.Errorf("no imap server advertised")
+	}
+	if !found["smtp"] {
+		return fmt.Errorf("no smtp server advertised")
+	}
+	return nil
+}
+
+// compare exports a match series per advertised endpoint. Protocols without expected
+// hosts are not compared.
+func (t *Tester) compare(source string, endpoints []endpoint) {
+	autoconfigEndpointMatch.DeletePartialMatch(prometheus.Labels{"domain": t.cfg.Domain, "source": source})
+
+	mismatches := 0
+	for _, e := range endpoints {
+		expected := t.expected[e.protocol]
+		if len(expected) == 0 {
+			continue
+		}
+		match := expected[normalizeHost(e.host)]
+		if !match {
+			mismatches++
+			t.log().Warn("Unexpected host advertised", "source", source, "protocol", e.protocol,
+				"host", e.host, "port", e.port)
+		}
+		autoconfigEndpointMatch.WithLabelValues(t.cfg.Domain, source, e.protocol, e.host, e.portLabel()).
+			Set(boolToFloat(match))
+	}
+	autoconfigMismatches.WithLabelValues(t.cfg.Domain, source).Set(float64(mismatches))
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
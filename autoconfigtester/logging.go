@@ -0,0 +1,14 @@
+package autoconfigtester
+
+import (
+	"log/slog"
+
+	"github.com/dniminenn/mailmetrix/logging"
+)
+
+var logger = logging.New("autoconfig")
+
+// log returns the logger with the attributes identifying this tester.
+func (t *Tester) log() *slog.Logger {
+	return logger.With("server", t.cfg.Domain, "type", "autoconfig")
+}
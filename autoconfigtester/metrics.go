@@ -0,0 +1,69 @@
+package autoconfigtester
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	autoconfigValid = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "autoconfig_valid",
+			Help:      "Whether the source returned a usable IMAP and SMTP configuration (1) or not (0)",
+			Namespace: "mailmetrix",
+		},
+		[]string{"domain", "source"},
+	)
+	autoconfigLookupTime = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "autoconfig_lookup_seconds",
+			Help:      "Time to fetch and parse the configuration from the source",
+			Namespace: "mailmetrix",
+		},
+		[]string{"domain", "source"},
+	)
+	autoconfigEndpointMatch = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "autoconfig_endpoint_match",
+			Help:      "Whether an advertised endpoint is one of the expected hosts (1) or not (0)",
+			Namespace: "mailmetrix",
+		},
+		[]string{"domain", "source", "protocol", "host", "port"},
+	)
+	autoconfigMismatches = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "autoconfig_mismatches",
+			Help:      "Number of advertised endpoints that are not among the expected hosts",
+			Namespace: "mailmetrix",
+		},
+		[]string{"domain", "source"},
+	)
+	autoconfigFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "autoconfig_failures_total",
+			Help:      "Total number of autoconfig lookup failures",
+			Namespace: "mailmetrix",
+		},
+		[]string{"domain", "source"},
+	)
+)
+
+func init() {
+	metrics := []prometheus.Collector{
+		autoconfigValid,
+		autoconfigLookupTime,
+		autoconfigEndpointMatch,
+		autoconfigMismatches,
+		autoconfigFailures,
+	}
+
+	for _, metric := range metrics {
+		if err := prometheus.Register(metric); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				prometheus.Unregister(are.ExistingCollector)
+				prometheus.MustRegister(metric)
+			} else {
+				logger.Error("Error registering metric", "error", err)
+			}
+		}
+	}
+}
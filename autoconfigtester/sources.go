@@ -0,0 +1,264 @@
+package autoconfigtester
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dniminenn/mailmetrix/errclass"
+)
+
+// endpoint is a server advertised for the "imap" or "smtp" protocol.
+type endpoint struct {
+	protocol string
+	host     string
+	port     int
+}
+
+// mozillaConfig is the subset of the Thunderbird autoconfig (config-v1.1.xml) format
+// the probe reads.
+type mozillaConfig struct {
+	XMLName  xml.Name `xml:"clientConfig"`
+	Provider struct {
+		Incoming []mozillaServer `xml:"incomingServer"`
+		Outgoing []mozillaServer `xml:"outgoingServer"`
+	} `xml:"emailProvider"`
+}
+
+type mozillaServer struct {
+	Type     string `xml:"type,attr"`
+	Hostname string `xml:"hostname"`
+	Port     int    `xml:"port"`
+}
+
+// fetchMozilla tries the autoconfig subdomain and then the well-known path on the domain.
+func (t *Tester) fetchMozilla(ctx context.Context) ([]endpoint, error) {
+	query := "?emailaddress=" + url.QueryEscape(t.email)
+	urls := []string{
+		"https://autoconfig." + t.cfg.Domain + "/mail/config-v1.1.xml" + query,
+		"https://" + t.cfg.Domain + "/.well-known/autoconfig/mail/config-v1.1.xml" + query,
+	}
+
+	var errs []error
+	for _, u := range urls {
+		body, err := t.fetch(ctx, "GET", u, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		var cfg mozillaConfig
+		if err := xml.Unmarshal(body, &cfg); err != nil {
+			errs = append(errs, errclass.Errorf(errclass.UnexpectedContent, "%s: invalid config: %w", u, err))
+			continue
+		}
+		var endpoints []endpoint
+		for _, s := range append(cfg.Provider.Incoming, cfg.Provider.Outgoing...) {
+			if s.Type == "imap" || s.Type == "smtp" {
+				endpoints = append(endpoints, endpoint{s.Type, t.expand(s.Hostname), s.Port})
+			}
+		}
+		return endpoints, nil
+	}
+	return nil, joinErrors(errs)
+}
+
+// joinErrors combines the errors of the URLs that were tried, keeping the reason of the
+// first so the failure is not reported as a protocol error.
+func joinErrors(errs []error) error {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return errclass.New(errclass.Classify(errs[0]), errors.New(strings.Join(messages, "; ")))
+}
+
+// expand replaces the autoconfig placeholders with parts of the probe address.
+func (t *Tester) expand(s string) string {
+	local, _, _ := strings.Cut(t.email, "@")
+	return strings.NewReplacer(
+		"%EMAILADDRESS%", t.email,
+		"%EMAILLOCALPART%", local,
+		"%EMAILDOMAIN%", t.cfg.Domain,
+	).Replace(s)
+}
+
+const autodiscoverRequest = `<?xml version="1.0" encoding="utf-8"?>
+<Autodiscover xmlns="http://schemas.microsoft.com/exchange/autodiscover/outlook/requestschema/2006">
+  <Request>
+    <EMailAddress>%s</EMailAddress>
+    <AcceptableResponseSchema>http://schemas.microsoft.com/exchange/autodiscover/outlook/responseschema/2006a</AcceptableResponseSchema>
+  </Request>
+</Autodiscover>`
+
+// autodiscoverResponse is the subset of the Outlook POX Autodiscover response the probe reads.
+type autodiscoverResponse struct {
+	XMLName  xml.Name `xml:"Autodiscover"`
+	Response struct {
+		Error struct {
+			ErrorCode string `xml:"ErrorCode"`
+			Message   string `xml:"Message"`
+		} `xml:"Error"`
+		Account struct {
+			Action       string `xml:"Action"`
+			RedirectURL  string `xml:"RedirectUrl"`
+			RedirectAddr string `xml:"RedirectAddr"`
+			Protocols    []struct {
+				Type   string `xml:"Type"`
+				Server string `xml:"Server"`
+				Port   int    `xml:"Port"`
+			} `xml:"Protocol"`
+		} `xml:"Account"`
+	} `xml:"Response"`
+}
+
+// maxAutodiscoverRedirects bounds redirectUrl and redirectAddr responses.
+const maxAutodiscoverRedirects = 2
+
+// fetchAutodiscover posts a POX request to the domain and then to the autodiscover subdomain.
+func (t *Tester) fetchAutodiscover(ctx context.Context) ([]endpoint, error) {
+	urls := []string{
+		"https://" + t.cfg.Domain + "/autodiscover/autodiscover.xml",
+		"https://autodiscover." + t.cfg.Domain + "/autodiscover/autodiscover.xml",
+	}
+
+	var errs []error
+	for _, u := range urls {
+		endpoints, err := t.autodiscover(ctx, u, t.email, maxAutodiscoverRedirects)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return endpoints, nil
+	}
+	return nil, joinErrors(errs)
+}
+
+func (t *Tester) autodiscover(ctx context.Context, u, email string, redirects int) ([]endpoint, error) {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(email))
+	body, err := t.fetch(ctx, "POST", u, []byte(fmt.Sprintf(autodiscoverRequest, escaped.String())))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp autodiscoverResponse
+	if err := xml.Unmarshal(body, &resp); err != nil {
+		return nil, errclass.Errorf(errclass.UnexpectedContent, "%s: invalid response: %w", u, err)
+	}
+	if e := resp.Response.Error; e.ErrorCode != "" {
+		return nil, errclass.Errorf(errclass.UnexpectedContent, "%s: error %s: %s", u, e.ErrorCode, e.Message)
+	}
+
+	account := resp.Response.Account
+	switch account.Action {
+	case "redirectUrl", "redirectAddr":
+		if redirects == 0 {
+			return nil, errclass.Errorf(errclass.UnexpectedContent, "%s: too many redirects", u)
+		}
+		if account.Action == "redirectUrl" {
+			// The credentials are sent along, so only servers of the domain are trusted.
+			if !t.trustedRedirect(account.RedirectURL) {
+				return nil, errclass.Errorf(errclass.UnexpectedContent, "%s: refusing redirect to %q", u, account.RedirectURL)
+			}
+			return t.autodiscover(ctx, account.RedirectURL, email, redirects-1)
+		}
+		return t.autodiscover(ctx, u, account.RedirectAddr, redirects-1)
+	}
+
+	var endpoints []endpoint
+	for _, p := range account.Protocols {
+		switch strings.ToUpper(p.Type) {
+		case "IMAP":
+			endpoints = append(endpoints, endpoint{"imap", p.Server, p.Port})
+		case "SMTP":
+			endpoints = append(endpoints, endpoint{"smtp", p.Server, p.Port})
+		}
+	}
+	return endpoints, nil
+}
+
+// trustedRedirect reports whether u is an https URL on the probed domain or one of its
+// subdomains.
+func (t *Tester) trustedRedirect(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	domain := strings.ToLower(strings.TrimSuffix(t.cfg.Domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// fetch sends the request and returns the body of a 200 response.
+func (t *Tester) fetch(ctx context.Context, method, u string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to create request: %w", u, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	}
+	if t.cfg.Username != "" {
+		req.SetBasicAuth(t.cfg.Username, t.cfg.Password)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s: %w", u, &errclass.HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to read response: %w", u, err)
+	}
+	return data, nil
+}
+
+// srvServices maps the RFC 6186 and RFC 8314 service names to protocols.
+var srvServices = []struct {
+	service  string
+	protocol string
+}{
+	{"imaps", "imap"},
+	{"imap", "imap"},
+	{"submissions", "smtp"},
+	{"submission", "smtp"},
+}
+
+// lookupSRV collects the SRV targets; a target of "." means the service is not offered.
+func (t *Tester) lookupSRV(ctx context.Context) ([]endpoint, error) {
+	var endpoints []endpoint
+	for _, s := range srvServices {
+		_, records, err := t.resolver.LookupSRV(ctx, s.service, "tcp", t.cfg.Domain)
+		if err != nil {
+			if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+				continue
+			}
+			return nil, fmt.Errorf("_%s._tcp lookup failed: %w", s.service, err)
+		}
+		for _, r := range records {
+			if r.Target == "." {
+				continue
+			}
+			endpoints = append(endpoints, endpoint{s.protocol, r.Target, int(r.Port)})
+		}
+	}
+	return endpoints, nil
+}
+
+func (e endpoint) portLabel() string {
+	return strconv.Itoa(e.port)
+}
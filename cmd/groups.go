@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/dniminenn/mailmetrix/autoconfigtester"
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/davtester"
+	"github.com/dniminenn/mailmetrix/dnstester"
+	"github.com/dniminenn/mailmetrix/imaptester"
+	"github.com/dniminenn/mailmetrix/sievetester"
+	"github.com/dniminenn/mailmetrix/smtptester"
+	"github.com/dniminenn/mailmetrix/webmailtester"
+)
+
+// newProbeGroups creates the testers for the targets of cfg. imapHosts are compared with
+// the settings advertised by autoconfig.
+func newProbeGroups(cfg *config.Config, imapHosts []string) []*probeGroup {
+	var imapTesters []sessionTester
+	for _, server := range cfg.IMAP.Servers {
+		imapTesters = append(imapTesters, imaptester.NewTester(server))
+	}
+
+	var webmailTesters []sessionTester
+	for _, server := range cfg.Webmail.Servers {
+		wtester, err := webmailtester.NewWebmailTester(server)
+		if err != nil {
+			logger.Warn("Skipping webmail server", "server", server.Name, "type", "webmail", "error", err)
+			continue
+		}
+		webmailTesters = append(webmailTesters, wtester)
+	}
+
+	var dnsTesters []sessionTester
+	for _, domain := range cfg.DNS.Domains {
+		dnsTesters = append(dnsTesters, dnstester.NewTester(domain, cfg.DNS.Resolver))
+	}
+
+	dnsblResolver := cfg.DNS.DNSBL.Resolver
+	if dnsblResolver == "" {
+		dnsblResolver = cfg.DNS.Resolver
+	}
+	var dnsblTesters []sessionTester
+	for _, ip := range cfg.DNS.DNSBL.IPs {
+		dnsblTesters = append(dnsblTesters, dnstester.NewDNSBLTester(ip, cfg.DNS.DNSBL.Zones, dnsblResolver))
+	}
+
+	var smtpTesters []sessionTester
+	for _, server := range cfg.SMTP.Servers {
+		smtpTesters = append(smtpTesters, smtptester.NewTester(server, cfg.DNS.Resolver))
+	}
+
+	var sieveTesters []sessionTester
+	for _, server := range cfg.Sieve.Servers {
+		sieveTesters = append(sieveTesters, sievetester.NewTester(server))
+	}
+
+	var davTesters []sessionTester
+	for _, server := range cfg.DAV.Servers {
+		dtester, err := davtester.NewDAVTester(server)
+		if err != nil {
+			logger.Warn("Skipping DAV server", "server", server.Name, "type", "dav", "error", err)
+			continue
+		}
+		davTesters = append(davTesters, dtester)
+	}
+
+	var autoconfigTesters []sessionTester
+	for _, domain := range cfg.Autoconfig.Domains {
+		autoconfigTesters = append(autoconfigTesters, autoconfigtester.NewTester(domain, imapHosts, cfg.DNS.Resolver))
+	}
+
+	return []*probeGroup{
+		newProbeGroup("IMAP", imapTesters),
+		newProbeGroup("Webmail", webmailTesters),
+		newProbeGroup("DNS", dnsTesters),
+		newProbeGroup("DNSBL", dnsblTesters),
+		newProbeGroup("SMTP", smtpTesters),
+		newProbeGroup("Sieve", sieveTesters),
+		newProbeGroup("DAV", davTesters),
+		newProbeGroup("Autoconfig", autoconfigTesters),
+	}
+}
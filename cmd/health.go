@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// serveHealth answers liveness probes: it fails when the schedule has not fired for
+// several intervals, which a restart would fix.
+func (s *scheduler) serveHealth(w http.ResponseWriter, r *http.Request) {
+	// testInterval is twice the schedule interval.
+	if since := time.Since(time.Unix(0, s.lastTick.Load())); since > 3*s.testInterval {
+		http.Error(w, "scheduler stalled for "+since.Round(time.Second).String(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// serveReady answers readiness probes: it passes once the first round of probes has
+// completed, so the metrics are complete when the instance is first scraped.
+func (s *scheduler) serveReady(w http.ResponseWriter, r *http.Request) {
+	if !s.ready.Load() {
+		http.Error(w, "waiting for the first round of probes", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
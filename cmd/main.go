@@ -3,145 +3,165 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
-	"sync"
+	"strings"
 	"time"
 
+	"github.com/dniminenn/mailmetrix/alert"
 	"github.com/dniminenn/mailmetrix/config"
-	"github.com/dniminenn/mailmetrix/imaptester"
-	"github.com/dniminenn/mailmetrix/webmailtester"
+	"github.com/dniminenn/mailmetrix/fleet"
+	"github.com/dniminenn/mailmetrix/history"
+	"github.com/dniminenn/mailmetrix/logging"
+	"github.com/dniminenn/mailmetrix/push"
+	"github.com/dniminenn/mailmetrix/results"
+	"github.com/dniminenn/mailmetrix/slo"
+	"github.com/dniminenn/mailmetrix/tracing"
+	"github.com/dniminenn/mailmetrix/transcript"
+	"github.com/dniminenn/mailmetrix/ui"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 )
 
+var logger = logging.New("cmd")
+
+// fatal logs the error and exits, as log.Fatal does.
+func fatal(msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
 func main() {
 	configPath := "/etc/mailmetrix/config.yaml"
 	if info, err := os.Stat("./config.yaml"); err == nil && !info.IsDir() {
 		configPath = "./config.yaml"
 	}
 
+	loadStart := time.Now()
 	cfg, err := config.LoadConfig(configPath)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fatal("Failed to load configuration", err)
+	}
+	if err := logging.Setup(cfg.Logging); err != nil {
+		fatal("Failed to set up logging", err)
 	}
+	configLoadDuration.Set(time.Since(loadStart).Seconds())
+	configLastReloadSuccess.SetToCurrentTime()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	var imapTesters []*imaptester.Tester
-	for _, server := range cfg.IMAP.Servers {
-		imapTesters = append(imapTesters, imaptester.NewTester(server))
-	}
-
-	var webmailTesters []webmailtester.WebmailTester
-	for _, server := range cfg.Webmail.Servers {
-		wtester, err := webmailtester.NewWebmailTester(server)
+	if cfg.Tracing.Endpoint != "" {
+		shutdown, err := tracing.Start(ctx, cfg.Tracing)
 		if err != nil {
-			log.Printf("Skipping webmail server %s: %v", server.Name, err)
-			continue
+			fatal("Failed to start tracing", err)
 		}
-		webmailTesters = append(webmailTesters, wtester)
+		defer shutdown(context.Background())
+		logger.Info("Exporting session traces", "endpoint", cfg.Tracing.Endpoint, "protocol", cfg.Tracing.Protocol)
 	}
 
-	imapLock := make(chan struct{}, 1)
-	webmailLock := make(chan struct{}, 1)
+	if len(cfg.SLO.Objectives) > 0 {
+		tracker := slo.NewTracker(cfg.SLO.Objectives)
+		tracker.Start(ctx)
+		results.Subscribe(tracker)
+	}
 
-	ticker := time.NewTicker(time.Duration(cfg.Metrics.TestInterval) * time.Second)
-	defer ticker.Stop()
+	if len(cfg.Alerting.Rules) > 0 {
+		results.Subscribe(alert.NewManager(cfg.Alerting))
+	}
 
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				go runIMAPTests(ctx, imapTesters, imapLock, time.Duration(cfg.Metrics.TestInterval)*time.Second*2)
-				go runWebmailTests(ctx, webmailTesters, webmailLock, time.Duration(cfg.Metrics.TestInterval)*time.Second*2)
-			case <-ctx.Done():
-				return
-			}
+	if cfg.History.Path != "" {
+		store, err := history.Open(cfg.History.Path, time.Duration(cfg.History.RetentionDays)*24*time.Hour)
+		if err != nil {
+			fatal("Failed to open result history", err)
 		}
-	}()
-
-	http.Handle("/metrics", promhttp.Handler())
-	address := fmt.Sprintf(":%d", cfg.Metrics.PrometheusPort)
-	log.Printf("Serving metrics on %s", address)
-	if err := http.ListenAndServe(address, nil); err != nil {
-		log.Fatalf("Failed to start metrics server: %v", err)
+		defer store.Close()
+		results.Subscribe(store)
+		http.Handle("/api/results", store.Handler())
 	}
-}
 
-func runWebmailTests(ctx context.Context, webmailTesters []webmailtester.WebmailTester,
-	lock chan struct{}, testInterval time.Duration) {
-	select {
-	case lock <- struct{}{}:
-		defer func() { <-lock }()
-
-		ctx, cancel := context.WithTimeout(ctx, testInterval*3)
-		defer cancel()
-
-		var wg sync.WaitGroup
-		for _, tester := range webmailTesters {
-			wg.Add(1)
-			go func(t webmailtester.WebmailTester) {
-				defer wg.Done()
-				if err := t.RunSession(ctx); err != nil {
-					log.Printf("Webmail test for server %s failed: %v", t.GetName(), err)
-				}
-			}(tester)
+	sched := &scheduler{
+		testInterval: time.Duration(cfg.Metrics.TestInterval) * time.Second * 2,
+	}
+	// An agent probes nothing until the controller assigns its targets.
+	if cfg.Agent.ControllerURL == "" {
+		var imapHosts []string
+		for _, server := range cfg.IMAP.Servers {
+			imapHosts = append(imapHosts, server.Host)
 		}
+		sched.setGroups(newProbeGroups(cfg, imapHosts))
+	}
 
-		done := make(chan struct{})
-		go func() {
-			wg.Wait()
-			close(done)
-		}()
-
-		select {
-		case <-done:
-			return
-		case <-ctx.Done():
-			log.Printf("Webmail tests timed out")
-			return
+	if cfg.Transcripts.Enabled {
+		sched.transcripts = transcript.NewStore(cfg.Transcripts.Keep)
+		http.Handle("/api/transcripts", sched.transcripts.Handler())
+		logger.Info("Recording protocol transcripts", "keep", cfg.Transcripts.Keep)
+	}
+
+	dashboard := ui.New(sched.targets(), func(kind, server string) error {
+		return sched.runNow(ctx, kind, server)
+	})
+	results.Subscribe(dashboard)
+	http.Handle("/", dashboard.Handler())
+
+	if len(cfg.Controller.Agents) > 0 {
+		controller, err := fleet.NewController(cfg, 3*time.Duration(cfg.Metrics.TestInterval)*time.Second)
+		if err != nil {
+			fatal("Failed to start controller", err)
 		}
-	default:
-		log.Println("Webmail tests are still running, skipping this iteration.")
+		results.Subscribe(controller)
+		http.Handle("/api/agent/", controller.AgentHandler())
+		http.Handle("/api/locations", controller.Handler())
+		logger.Info("Serving agents as controller", "agents", len(cfg.Controller.Agents), "location", cfg.Controller.Location)
 	}
-}
 
-func runIMAPTests(ctx context.Context, imapTesters []*imaptester.Tester,
-	lock chan struct{}, testInterval time.Duration) {
-	select {
-	case lock <- struct{}{}:
-		defer func() { <-lock }()
-
-		ctx, cancel := context.WithTimeout(ctx, testInterval*3)
-		defer cancel()
-
-		var wg sync.WaitGroup
-		for _, tester := range imapTesters {
-			wg.Add(1)
-			go func(t *imaptester.Tester) {
-				defer wg.Done()
-				if err := t.RunSession(ctx); err != nil {
-					log.Printf("IMAP test for server %s failed: %v", t.GetName(), err)
-				}
-			}(tester)
+	if cfg.Agent.ControllerURL != "" {
+		agent, err := fleet.NewAgent(cfg.Agent)
+		if err != nil {
+			fatal("Failed to start agent", err)
+		}
+		results.Subscribe(agent)
+		agent.Start(ctx, func(assignment *fleet.Assignment) {
+			applyStart := time.Now()
+			assigned := *cfg
+			assignment.Apply(&assigned)
+			sched.setGroups(newProbeGroups(&assigned, assignment.IMAPHosts))
+			dashboard.SetTargets(sched.targets())
+			configLoadDuration.Set(time.Since(applyStart).Seconds())
+			configLastReloadSuccess.SetToCurrentTime()
+		})
+		logger.Info("Running as agent", "controller", cfg.Agent.ControllerURL)
+		if strings.HasPrefix(cfg.Agent.ControllerURL, "http://") {
+			logger.Warn("Fetching the assignment over plain HTTP; target credentials are sent in cleartext",
+				"controller", cfg.Agent.ControllerURL)
 		}
+	}
 
-		done := make(chan struct{})
-		go func() {
-			wg.Wait()
-			close(done)
-		}()
-
-		select {
-		case <-done:
-			return
-		case <-ctx.Done():
-			log.Printf("IMAP tests timed out")
-			return
+	go sched.run(ctx, time.Duration(cfg.Metrics.TestInterval)*time.Second)
+
+	if cfg.Push.RemoteWrite.URL != "" || cfg.Push.OTLP.URL != "" {
+		if err := push.Start(ctx, cfg.Push, prometheus.DefaultGatherer); err != nil {
+			fatal("Failed to start metrics push", err)
 		}
-	default:
-		log.Println("IMAP tests are still running, skipping this iteration.")
+	}
+
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/healthz", sched.serveHealth)
+	http.HandleFunc("/readyz", sched.serveReady)
+
+	// The web config applies to every endpoint: metrics, dashboard, API and health checks.
+	addresses := cfg.Web.ListenAddresses
+	if len(addresses) == 0 {
+		addresses = []string{fmt.Sprintf(":%d", cfg.Metrics.PrometheusPort)}
+	}
+	systemdSocket := false
+	flags := &web.FlagConfig{
+		WebListenAddresses: &addresses,
+		WebSystemdSocket:   &systemdSocket,
+		WebConfigFile:      &cfg.Web.ConfigFile,
+	}
+	if err := web.ListenAndServe(&http.Server{Handler: http.DefaultServeMux}, flags, logger); err != nil {
+		fatal("Failed to start metrics server", err)
 	}
 }
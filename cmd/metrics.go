@@ -0,0 +1,101 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The goroutine count and memory use are exported by the default Go collector, as
+// go_goroutines and go_memstats_*.
+var (
+	buildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "build_info",
+			Help:      "Always 1, labeled with the version and VCS revision of the binary",
+			Namespace: "mailmetrix",
+		},
+		[]string{"version", "revision", "goversion"},
+	)
+	configLastReloadSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:      "config_last_reload_success_timestamp_seconds",
+			Help:      "Unix time the configuration, or the assignment of an agent, was last loaded",
+			Namespace: "mailmetrix",
+		},
+	)
+	configLoadDuration = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:      "config_load_duration_seconds",
+			Help:      "Time taken to load the configuration, or to apply the assignment of an agent, the last time",
+			Namespace: "mailmetrix",
+		},
+	)
+	configuredTargets = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "targets",
+			Help:      "Number of configured probe targets",
+			Namespace: "mailmetrix",
+		},
+		[]string{"kind"},
+	)
+	probesInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "probes_in_flight",
+			Help:      "Number of probe sessions currently running",
+			Namespace: "mailmetrix",
+		},
+		[]string{"kind"},
+	)
+	schedulerLag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "scheduler_lag_seconds",
+			Help:      "Delay between the scheduled time of the last run of the kind and its start",
+			Namespace: "mailmetrix",
+		},
+		[]string{"kind"},
+	)
+	schedulerSkippedRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "scheduler_skipped_runs_total",
+			Help:      "Total number of scheduled runs skipped because the previous run of the kind was still going",
+			Namespace: "mailmetrix",
+		},
+		[]string{"kind"},
+	)
+)
+
+func init() {
+	metrics := []prometheus.Collector{
+		buildInfo,
+		configLastReloadSuccess,
+		configLoadDuration,
+		configuredTargets,
+		probesInFlight,
+		schedulerLag,
+		schedulerSkippedRuns,
+	}
+
+	for _, metric := range metrics {
+		if err := prometheus.Register(metric); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				prometheus.Unregister(are.ExistingCollector)
+				prometheus.MustRegister(metric)
+			} else {
+				logger.Error("Error registering metric", "error", err)
+			}
+		}
+	}
+
+	version, revision := "unknown", "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version = info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				revision = setting.Value
+			}
+		}
+	}
+	buildInfo.WithLabelValues(version, revision, runtime.Version()).Set(1)
+}
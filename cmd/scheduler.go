@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/errclass"
+	"github.com/dniminenn/mailmetrix/results"
+	"github.com/dniminenn/mailmetrix/transcript"
+	"github.com/dniminenn/mailmetrix/ui"
+)
+
+// sessionTester is implemented by every tester the scheduler runs.
+type sessionTester interface {
+	RunSession(context.Context) error
+	GetName() string
+}
+
+// probeGroup is the set of testers of one kind. The lock keeps runs of a kind from
+// overlapping, whether started by the ticker or on demand.
+type probeGroup struct {
+	kind    string
+	testers []sessionTester
+	lock    chan struct{}
+}
+
+func newProbeGroup(kind string, testers []sessionTester) *probeGroup {
+	return &probeGroup{kind: kind, testers: testers, lock: make(chan struct{}, 1)}
+}
+
+// close releases the testers once their running sessions are done. The lock is never
+// given back, so the group cannot be run again.
+func (g *probeGroup) close() {
+	g.lock <- struct{}{}
+	for _, tester := range g.testers {
+		if c, ok := tester.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// scheduler runs the sessions of every probe group and records their results.
+type scheduler struct {
+	testInterval time.Duration
+	// transcripts keeps the transcripts of failed sessions; nil unless enabled.
+	transcripts *transcript.Store
+
+	// ready is set once the first round of probes has completed.
+	ready atomic.Bool
+	// lastTick is the UnixNano time the schedule last fired, or it started.
+	lastTick atomic.Int64
+
+	mu     sync.RWMutex
+	groups []*probeGroup
+}
+
+// run starts a round of every probe group right away and then each interval until ctx is
+// done, so the first results do not wait for a whole interval.
+func (s *scheduler) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	s.lastTick.Store(start.UnixNano())
+	s.runAll(ctx, start)
+	for {
+		select {
+		case scheduled := <-ticker.C:
+			s.lastTick.Store(time.Now().UnixNano())
+			s.runAll(ctx, scheduled)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *scheduler) currentGroups() []*probeGroup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.groups
+}
+
+// setGroups sets the probe groups, or replaces them when an agent is assigned other
+// targets.
+func (s *scheduler) setGroups(groups []*probeGroup) {
+	s.mu.Lock()
+	old := s.groups
+	s.groups = groups
+	s.mu.Unlock()
+
+	configuredTargets.Reset()
+	for _, group := range groups {
+		configuredTargets.WithLabelValues(strings.ToLower(group.kind)).Set(float64(len(group.testers)))
+	}
+	for _, group := range old {
+		go group.close()
+	}
+}
+
+func (s *scheduler) targets() []ui.Target {
+	var list []ui.Target
+	for _, group := range s.currentGroups() {
+		for _, tester := range group.testers {
+			list = append(list, ui.Target{Kind: strings.ToLower(group.kind), Server: tester.GetName()})
+		}
+	}
+	return list
+}
+
+// runAll starts a run of every probe group, and marks the scheduler ready when the first
+// round is done. An agent has no groups until the controller assigns its targets.
+func (s *scheduler) runAll(ctx context.Context, scheduled time.Time) {
+	groups := s.currentGroups()
+	if groups == nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runTests(ctx, group, scheduled)
+		}()
+	}
+	if !s.ready.Load() {
+		go func() {
+			wg.Wait()
+			if !s.ready.Swap(true) {
+				logger.Info("First probe round completed")
+			}
+		}()
+	}
+}
+
+func (s *scheduler) runTests(ctx context.Context, group *probeGroup, scheduled time.Time) {
+	select {
+	case group.lock <- struct{}{}:
+		defer func() { <-group.lock }()
+		schedulerLag.WithLabelValues(strings.ToLower(group.kind)).Set(time.Since(scheduled).Seconds())
+
+		ctx, cancel := context.WithTimeout(ctx, s.testInterval*3)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		for _, tester := range group.testers {
+			wg.Add(1)
+			go func(t sessionTester) {
+				defer wg.Done()
+				s.runSession(ctx, group.kind, t)
+			}(tester)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			logger.Warn("Tests timed out", "type", strings.ToLower(group.kind))
+			return
+		}
+	default:
+		logger.Warn("Tests are still running, skipping this iteration", "type", strings.ToLower(group.kind))
+		schedulerSkippedRuns.WithLabelValues(strings.ToLower(group.kind)).Inc()
+	}
+}
+
+// runSession runs one session and records its result, and its transcript if it failed.
+func (s *scheduler) runSession(ctx context.Context, kind string, t sessionTester) {
+	inFlight := probesInFlight.WithLabelValues(strings.ToLower(kind))
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	ctx, session := results.NewContext(ctx)
+	var tr *transcript.Transcript
+	if s.transcripts != nil {
+		ctx, tr = transcript.NewContext(ctx)
+	}
+	err := t.RunSession(ctx)
+	duration := time.Since(start)
+	attrs := []any{"type", strings.ToLower(kind), "server", t.GetName(), "operation", "session", "duration", duration}
+	var reason string
+	if err != nil {
+		reason = session.Reason()
+		if reason == "" {
+			reason = errclass.Classify(err)
+		}
+		logger.Warn("Session failed", append(attrs, "error_class", reason, "error", err)...)
+		if s.transcripts != nil {
+			s.transcripts.Add(strings.ToLower(kind), t.GetName(), start, err, tr)
+		}
+	} else {
+		logger.Debug("Session succeeded", attrs...)
+	}
+	results.Record(results.Result{
+		Kind:     kind,
+		Server:   t.GetName(),
+		Time:     start,
+		Duration: duration,
+		Err:      err,
+		Reason:   reason,
+		Session:  session,
+	})
+}
+
+// runNow starts a session of a single tester outside the schedule. It fails with
+// ui.ErrBusy while a run of the same kind is in progress.
+func (s *scheduler) runNow(ctx context.Context, kind, server string) error {
+	for _, group := range s.currentGroups() {
+		if !strings.EqualFold(group.kind, kind) {
+			continue
+		}
+		for _, tester := range group.testers {
+			if tester.GetName() != server {
+				continue
+			}
+			select {
+			case group.lock <- struct{}{}:
+			default:
+				return ui.ErrBusy
+			}
+			go func() {
+				defer func() { <-group.lock }()
+				ctx, cancel := context.WithTimeout(ctx, s.testInterval*3)
+				defer cancel()
+				logger.Info("Running test on demand", "type", strings.ToLower(group.kind), "server", server)
+				s.runSession(ctx, group.kind, tester)
+			}()
+			return nil
+		}
+	}
+	return ui.ErrUnknownTarget
+}
@@ -2,15 +2,32 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net"
 	"strings"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	IMAP    IMAPConfig    `mapstructure:"imap"`
-	Webmail WebmailConfig `mapstructure:"webmail"`
-	Metrics MetricsConfig `mapstructure:"metrics"`
+	IMAP        IMAPConfig       `mapstructure:"imap"`
+	Webmail     WebmailConfig    `mapstructure:"webmail"`
+	DNS         DNSConfig        `mapstructure:"dns"`
+	SMTP        SMTPConfig       `mapstructure:"smtp"`
+	Sieve       SieveConfig      `mapstructure:"sieve"`
+	DAV         DAVConfig        `mapstructure:"dav"`
+	Autoconfig  AutoconfigConfig `mapstructure:"autoconfig"`
+	SLO         SLOConfig        `mapstructure:"slo"`
+	History     HistoryConfig    `mapstructure:"history"`
+	Transcripts TranscriptConfig `mapstructure:"transcripts"`
+	Alerting    AlertingConfig   `mapstructure:"alerting"`
+	Tracing     TracingConfig    `mapstructure:"tracing"`
+	Push        PushConfig       `mapstructure:"push"`
+	Agent       AgentConfig      `mapstructure:"agent"`
+	Controller  ControllerConfig `mapstructure:"controller"`
+	Logging     LoggingConfig    `mapstructure:"logging"`
+	Web         WebConfig        `mapstructure:"web"`
+	Metrics     MetricsConfig    `mapstructure:"metrics"`
 }
 
 type IMAPConfig struct {
@@ -23,6 +40,22 @@ type ServerConfig struct {
 	Port     int    `mapstructure:"port"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
+	// Persistent keeps the logged-in connection open between test runs.
+	Persistent bool `mapstructure:"persistent"`
+	// ProbeAllAddresses runs a separate session against every resolved address of the host.
+	ProbeAllAddresses bool `mapstructure:"probe_all_addresses"`
+	// IPFamily restricts resolution to "ipv4" or "ipv6"; empty uses both.
+	IPFamily string `mapstructure:"ip_family"`
+	// AnalyzeDelivery inspects the headers of messages delivered by the SMTP probe.
+	AnalyzeDelivery bool `mapstructure:"analyze_delivery"`
+	// JunkFolder is searched for the probe message when the server does not advertise
+	// SPECIAL-USE or has no \Junk mailbox.
+	JunkFolder string `mapstructure:"junk_folder"`
+	// StatusFolders are checked with STATUS for message and unseen counts; defaults to INBOX.
+	StatusFolders []string `mapstructure:"status_folders"`
+	// QuotaWarningPercent is the quota usage above which a warning is logged before the
+	// append test; defaults to 90 when unset, and 0 disables the warning.
+	QuotaWarningPercent *float64 `mapstructure:"quota_warning_percent"`
 }
 
 type WebmailConfig struct {
@@ -36,6 +69,275 @@ type WebmailServerConfig struct {
 	BaseURL   string `mapstructure:"base_url"`
 	Username  string `mapstructure:"username"`
 	Password  string `mapstructure:"password"`
+	// Auth selects "basic" (default) or "ntlm" authentication for the Exchange testers.
+	Auth string `mapstructure:"auth"`
+}
+
+type DNSConfig struct {
+	// Resolver is the host:port of the DNS server to query; empty uses the system resolver.
+	Resolver string            `mapstructure:"resolver"`
+	Domains  []DNSDomainConfig `mapstructure:"domains"`
+	DNSBL    DNSBLConfig       `mapstructure:"dnsbl"`
+}
+
+type DNSDomainConfig struct {
+	Domain        string   `mapstructure:"domain"`
+	ExpectedMX    []string `mapstructure:"expected_mx"`
+	DKIMSelectors []string `mapstructure:"dkim_selectors"`
+}
+
+type DNSBLConfig struct {
+	// Resolver overrides dns.resolver for blocklist queries, since some lists refuse
+	// queries relayed through public resolvers.
+	Resolver string   `mapstructure:"resolver"`
+	IPs      []string `mapstructure:"ips"`
+	Zones    []string `mapstructure:"zones"`
+}
+
+type SMTPConfig struct {
+	Servers []SMTPServerConfig `mapstructure:"servers"`
+}
+
+type SMTPServerConfig struct {
+	Name string `mapstructure:"name"`
+	// Domain is resolved for MX records unless Hosts lists the MX hosts explicitly.
+	Domain   string   `mapstructure:"domain"`
+	Hosts    []string `mapstructure:"hosts"`
+	Port     int      `mapstructure:"port"`
+	Helo     string   `mapstructure:"helo"`
+	MailFrom string   `mapstructure:"mail_from"`
+	RcptTo   string   `mapstructure:"rcpt_to"`
+	// SendData finishes the transaction with DATA instead of RSET.
+	SendData bool `mapstructure:"send_data"`
+}
+
+type SieveConfig struct {
+	Servers []SieveServerConfig `mapstructure:"servers"`
+}
+
+type SieveServerConfig struct {
+	Name     string `mapstructure:"name"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// UploadScript uploads, checks and deletes a small test script after LISTSCRIPTS.
+	UploadScript bool `mapstructure:"upload_script"`
+	// AllowInsecureAuth authenticates in cleartext when the server does not offer STARTTLS,
+	// instead of failing the starttls step.
+	AllowInsecureAuth bool `mapstructure:"allow_insecure_auth"`
+}
+
+type DAVConfig struct {
+	Servers []DAVServerConfig `mapstructure:"servers"`
+}
+
+type DAVServerConfig struct {
+	Name      string `mapstructure:"name"`
+	Type      string `mapstructure:"type"`
+	UserAgent string `mapstructure:"user_agent"`
+	BaseURL   string `mapstructure:"base_url"`
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password"`
+	// WriteTest creates and deletes a test event or contact after the REPORT.
+	WriteTest bool `mapstructure:"write_test"`
+}
+
+type AutoconfigConfig struct {
+	Domains []AutoconfigDomainConfig `mapstructure:"domains"`
+}
+
+type AutoconfigDomainConfig struct {
+	Domain string `mapstructure:"domain"`
+	// Email is the address sent to autoconfig and Autodiscover; defaults to postmaster@domain.
+	Email string `mapstructure:"email"`
+	// Username and Password are sent as Basic credentials to Autodiscover when set.
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// SubmissionHosts are the expected SMTP hosts; advertised IMAP hosts are compared
+	// with imap.servers.
+	SubmissionHosts []string `mapstructure:"submission_hosts"`
+}
+
+type SLOConfig struct {
+	Objectives []SLOObjectiveConfig `mapstructure:"objectives"`
+}
+
+type SLOObjectiveConfig struct {
+	Name string `mapstructure:"name"`
+	// Kind is the tester kind the objective covers: imap, webmail, dns, dnsbl, smtp, sieve,
+	// dav or autoconfig.
+	Kind string `mapstructure:"kind"`
+	// Server restricts the objective to one server; empty covers every server of the kind.
+	Server string `mapstructure:"server"`
+	// Target is the percentage of successful sessions, such as 99.9.
+	Target float64 `mapstructure:"target"`
+	// WindowDays is the compliance period the error budget is computed over.
+	WindowDays int `mapstructure:"window_days"`
+}
+
+type HistoryConfig struct {
+	// Path is the database file results are stored in; empty disables the history.
+	Path          string `mapstructure:"path"`
+	RetentionDays int    `mapstructure:"retention_days"`
+}
+
+// TranscriptConfig enables the debug mode recording the protocol exchange of IMAP and
+// webmail sessions. The transcripts of the last failing sessions are kept per server.
+type TranscriptConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	Keep    int  `mapstructure:"keep"`
+}
+
+// AlertingConfig holds the rules evaluated on every probe result and the notifiers
+// firing and resolved alerts are sent to.
+type AlertingConfig struct {
+	// RepeatIntervalMinutes is how often an alert that is still firing is sent again.
+	RepeatIntervalMinutes int                   `mapstructure:"repeat_interval_minutes"`
+	Rules                 []AlertRuleConfig     `mapstructure:"rules"`
+	Notifiers             []AlertNotifierConfig `mapstructure:"notifiers"`
+}
+
+type AlertRuleConfig struct {
+	Name string `mapstructure:"name"`
+	// Type is consecutive_failures, step_duration or cert_expiry.
+	Type string `mapstructure:"type"`
+	// Kind and Server restrict the rule to the results of one tester kind or server.
+	Kind   string `mapstructure:"kind"`
+	Server string `mapstructure:"server"`
+	// Failures is the number of consecutive failed sessions a consecutive_failures rule fires at.
+	Failures int `mapstructure:"failures"`
+	// Step is the session step, such as "authentication" or "login", a step_duration rule
+	// compares against ThresholdSeconds.
+	Step             string  `mapstructure:"step"`
+	ThresholdSeconds float64 `mapstructure:"threshold_seconds"`
+	// ForMinutes is how long the condition must hold before the alert fires.
+	ForMinutes int `mapstructure:"for_minutes"`
+	// Days is how close to expiry a server certificate fires a cert_expiry rule.
+	Days int `mapstructure:"days"`
+}
+
+type AlertNotifierConfig struct {
+	Name string `mapstructure:"name"`
+	// Type is webhook, slack or email. Slack messages are also accepted by Mattermost.
+	Type string `mapstructure:"type"`
+	URL  string `mapstructure:"url"`
+	// The SMTP submission server email notifications are sent through, with STARTTLS
+	// when the server offers it.
+	Host     string   `mapstructure:"host"`
+	Port     int      `mapstructure:"port"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+}
+
+// TracingConfig exports a trace of every IMAP and webmail session to an OTLP collector.
+type TracingConfig struct {
+	// Endpoint is the host:port of the collector; empty disables tracing.
+	Endpoint string `mapstructure:"endpoint"`
+	// Protocol is grpc or http.
+	Protocol string            `mapstructure:"protocol"`
+	Insecure bool              `mapstructure:"insecure"`
+	Headers  map[string]string `mapstructure:"headers"`
+}
+
+// PushConfig sends the metrics to receivers that cannot scrape this instance, such as
+// probes behind NAT.
+type PushConfig struct {
+	// IntervalSeconds is how often the metrics are gathered and queued for each receiver.
+	IntervalSeconds int `mapstructure:"interval_seconds"`
+	// ExternalLabels are added to every series, or to the resource for OTLP.
+	ExternalLabels map[string]string `mapstructure:"external_labels"`
+	RemoteWrite    PushTargetConfig  `mapstructure:"remote_write"`
+	OTLP           PushTargetConfig  `mapstructure:"otlp"`
+}
+
+type PushTargetConfig struct {
+	// URL is the remote-write or OTLP/HTTP endpoint, such as
+	// http://collector:4318/v1/metrics; empty disables the push mode. With the grpc
+	// protocol it is the host:port of the collector.
+	URL string `mapstructure:"url"`
+	// Protocol is http or grpc; remote-write is always http.
+	Protocol string            `mapstructure:"protocol"`
+	Insecure bool              `mapstructure:"insecure"`
+	Username string            `mapstructure:"username"`
+	Password string            `mapstructure:"password"`
+	Headers  map[string]string `mapstructure:"headers"`
+	// BatchSize is the maximum number of series sent in one request.
+	BatchSize int `mapstructure:"batch_size"`
+	// BufferDir keeps the unsent requests on disk, so they survive a restart while the
+	// receiver is down. It is required with a URL.
+	BufferDir   string `mapstructure:"buffer_dir"`
+	MaxBufferMB int    `mapstructure:"max_buffer_mb"`
+}
+
+// AgentConfig runs this instance as a probe agent at a remote location: its targets come
+// from the controller and its results are reported back to it.
+type AgentConfig struct {
+	// ControllerURL is the base URL of the controller, such as
+	// https://mailmetrix.example.com; empty runs standalone.
+	ControllerURL string `mapstructure:"controller_url"`
+	// Insecure allows an http:// controller URL, which sends the target credentials of the
+	// assignment in cleartext.
+	Insecure bool `mapstructure:"insecure"`
+	// Token identifies the agent, and with it its location, to the controller.
+	Token string `mapstructure:"token"`
+	// Username and Password are sent when the web config of the controller requires
+	// basic auth.
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// CAFile verifies the certificate of the controller instead of the system roots.
+	CAFile string `mapstructure:"ca_file"`
+	// CertFile and KeyFile are the client certificate presented to a controller that
+	// requires one. They are read again for every connection.
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// PollIntervalSeconds is how often the agent checks for a changed assignment.
+	PollIntervalSeconds int `mapstructure:"poll_interval_seconds"`
+}
+
+// ControllerConfig lets probe agents fetch their targets from this instance and report
+// their results to it, so every result is exposed with the location it was measured from.
+type ControllerConfig struct {
+	// Location labels the results of the probes this instance runs itself.
+	Location string                `mapstructure:"location"`
+	Agents   []AgentLocationConfig `mapstructure:"agents"`
+}
+
+type AgentLocationConfig struct {
+	Location string `mapstructure:"location"`
+	Token    string `mapstructure:"token"`
+	// Targets are the configured targets the agent probes; empty assigns all of them.
+	Targets []TargetConfig `mapstructure:"targets"`
+}
+
+// TargetConfig selects a configured target by kind and name; an empty server selects
+// every target of the kind.
+type TargetConfig struct {
+	Kind   string `mapstructure:"kind"`
+	Server string `mapstructure:"server"`
+}
+
+type LoggingConfig struct {
+	// Format is text or json.
+	Format string `mapstructure:"format"`
+	// Level is the minimum level logged: debug, info, warn or error.
+	Level string `mapstructure:"level"`
+	// Levels overrides the level of a package logger, such as imap or push; see
+	// validateLogging for the names.
+	Levels map[string]string `mapstructure:"levels"`
+}
+
+// WebConfig controls the HTTP server of the metrics, the dashboard, the API and the
+// health endpoints.
+type WebConfig struct {
+	// ListenAddresses defaults to ":<metrics.prometheus_port>".
+	ListenAddresses []string `mapstructure:"listen_addresses"`
+	// ConfigFile is a Prometheus exporter-toolkit web configuration file with the TLS
+	// certificate, client certificate authentication and bcrypt basic-auth users. It is
+	// read for every connection, so renewed certificates are picked up without a restart.
+	ConfigFile string `mapstructure:"config_file"`
 }
 
 type MetricsConfig struct {
@@ -49,6 +351,20 @@ func LoadConfig(path string) (*Config, error) {
 	// Set defaults
 	v.SetDefault("metrics.prometheus_port", 9090)
 	v.SetDefault("metrics.test_interval", 30)
+	v.SetDefault("history.retention_days", 7)
+	v.SetDefault("transcripts.keep", 5)
+	v.SetDefault("alerting.repeat_interval_minutes", 240)
+	v.SetDefault("tracing.protocol", "grpc")
+	v.SetDefault("push.interval_seconds", 30)
+	for _, target := range []string{"remote_write", "otlp"} {
+		v.SetDefault("push."+target+".protocol", "http")
+		v.SetDefault("push."+target+".batch_size", 2000)
+		v.SetDefault("push."+target+".max_buffer_mb", 256)
+	}
+	v.SetDefault("agent.poll_interval_seconds", 60)
+	v.SetDefault("controller.location", "central")
+	v.SetDefault("logging.format", "text")
+	v.SetDefault("logging.level", "info")
 
 	// Configure viper
 	v.SetConfigFile(path)
@@ -85,6 +401,138 @@ func validateConfig(cfg *Config) error {
 		}
 	}
 
+	if cfg.DNS.Resolver != "" {
+		if _, _, err := net.SplitHostPort(cfg.DNS.Resolver); err != nil {
+			return fmt.Errorf("dns resolver must be host:port: %w", err)
+		}
+	}
+	for i, domain := range cfg.DNS.Domains {
+		if domain.Domain == "" {
+			return fmt.Errorf("dns domain %d: domain cannot be empty", i)
+		}
+	}
+
+	if cfg.DNS.DNSBL.Resolver != "" {
+		if _, _, err := net.SplitHostPort(cfg.DNS.DNSBL.Resolver); err != nil {
+			return fmt.Errorf("dnsbl resolver must be host:port: %w", err)
+		}
+	}
+	for i, ip := range cfg.DNS.DNSBL.IPs {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("dnsbl ip %d: invalid address %q", i, ip)
+		}
+	}
+	for i, zone := range cfg.DNS.DNSBL.Zones {
+		if zone == "" {
+			return fmt.Errorf("dnsbl zone %d: zone cannot be empty", i)
+		}
+	}
+
+	for i, server := range cfg.Sieve.Servers {
+		if err := validateSieveServer(server, i); err != nil {
+			return err
+		}
+	}
+
+	for i, server := range cfg.DAV.Servers {
+		if err := validateDAVServer(server, i); err != nil {
+			return err
+		}
+	}
+
+	for i, server := range cfg.SMTP.Servers {
+		if err := validateSMTPServer(server, i); err != nil {
+			return err
+		}
+	}
+
+	for i, domain := range cfg.Autoconfig.Domains {
+		if domain.Domain == "" {
+			return fmt.Errorf("autoconfig domain %d: domain cannot be empty", i)
+		}
+		if domain.Email != "" && !strings.Contains(domain.Email, "@") {
+			return fmt.Errorf("autoconfig domain %d: invalid email %q", i, domain.Email)
+		}
+	}
+
+	for i, objective := range cfg.SLO.Objectives {
+		if err := validateSLOObjective(objective, i); err != nil {
+			return err
+		}
+	}
+
+	if cfg.History.Path != "" && cfg.History.RetentionDays <= 0 {
+		return fmt.Errorf("history retention_days must be positive")
+	}
+
+	if cfg.Transcripts.Enabled && cfg.Transcripts.Keep <= 0 {
+		return fmt.Errorf("transcripts keep must be positive")
+	}
+
+	if len(cfg.Alerting.Rules) > 0 && cfg.Alerting.RepeatIntervalMinutes <= 0 {
+		return fmt.Errorf("alerting repeat_interval_minutes must be positive")
+	}
+	for i, rule := range cfg.Alerting.Rules {
+		if err := validateAlertRule(rule, i); err != nil {
+			return err
+		}
+	}
+	for i, notifier := range cfg.Alerting.Notifiers {
+		if err := validateAlertNotifier(notifier, i); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Tracing.Endpoint != "" && cfg.Tracing.Protocol != "grpc" && cfg.Tracing.Protocol != "http" {
+		return fmt.Errorf("tracing protocol must be grpc or http")
+	}
+
+	if cfg.Push.RemoteWrite.URL != "" || cfg.Push.OTLP.URL != "" {
+		if cfg.Push.IntervalSeconds <= 0 {
+			return fmt.Errorf("push interval_seconds must be positive")
+		}
+		if err := validatePushTarget(cfg.Push.RemoteWrite, "remote_write"); err != nil {
+			return err
+		}
+		if err := validatePushTarget(cfg.Push.OTLP, "otlp"); err != nil {
+			return err
+		}
+		if cfg.Push.RemoteWrite.URL != "" && cfg.Push.RemoteWrite.Protocol != "http" {
+			return fmt.Errorf("push remote_write: protocol must be http")
+		}
+	}
+
+	if cfg.Agent.ControllerURL != "" {
+		if err := validateAgent(cfg); err != nil {
+			return err
+		}
+	}
+	locations := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for i, agent := range cfg.Controller.Agents {
+		if err := validateAgentLocation(agent, i); err != nil {
+			return err
+		}
+		if agent.Location == cfg.Controller.Location || locations[agent.Location] {
+			return fmt.Errorf("controller agent %d: duplicate location %q", i, agent.Location)
+		}
+		if tokens[agent.Token] {
+			return fmt.Errorf("controller agent %d: duplicate token", i)
+		}
+		locations[agent.Location] = true
+		tokens[agent.Token] = true
+	}
+
+	if err := validateLogging(cfg.Logging); err != nil {
+		return err
+	}
+
+	for i, address := range cfg.Web.ListenAddresses {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("web listen address %d: %w", i, err)
+		}
+	}
+
 	return nil
 }
 
@@ -104,6 +552,31 @@ func validateServer(server ServerConfig, serverType string, index int) error {
 	if server.Password == "" {
 		return fmt.Errorf("%s server %d: password cannot be empty", serverType, index)
 	}
+	if server.IPFamily != "" && server.IPFamily != "ipv4" && server.IPFamily != "ipv6" {
+		return fmt.Errorf("%s server %d: ip_family must be ipv4 or ipv6, got %q", serverType, index, server.IPFamily)
+	}
+	if p := server.QuotaWarningPercent; p != nil && (*p < 0 || *p > 100) {
+		return fmt.Errorf("%s server %d: quota_warning_percent must be between 0 and 100", serverType, index)
+	}
+	return nil
+}
+
+func validateSieveServer(server SieveServerConfig, index int) error {
+	if server.Name == "" {
+		return fmt.Errorf("Sieve server %d: name cannot be empty", index)
+	}
+	if server.Host == "" {
+		return fmt.Errorf("Sieve server %d: host cannot be empty", index)
+	}
+	if server.Port <= 0 || server.Port > 65535 {
+		return fmt.Errorf("Sieve server %d: invalid port number: %d", index, server.Port)
+	}
+	if server.Username == "" {
+		return fmt.Errorf("Sieve server %d: username cannot be empty", index)
+	}
+	if server.Password == "" {
+		return fmt.Errorf("Sieve server %d: password cannot be empty", index)
+	}
 	return nil
 }
 
@@ -120,5 +593,211 @@ func validateWebmailServer(server WebmailServerConfig, index int) error {
 	if !strings.HasPrefix(server.BaseURL, "http://") && !strings.HasPrefix(server.BaseURL, "https://") {
 		return fmt.Errorf("webmail server %d: base_url must start with http:// or https://", index)
 	}
+	if server.Auth != "" && server.Auth != "basic" && server.Auth != "ntlm" {
+		return fmt.Errorf("webmail server %d: auth must be basic or ntlm", index)
+	}
+	return nil
+}
+
+func validateSMTPServer(server SMTPServerConfig, index int) error {
+	if server.Name == "" {
+		return fmt.Errorf("smtp server %d: name cannot be empty", index)
+	}
+	if server.Domain == "" && len(server.Hosts) == 0 {
+		return fmt.Errorf("smtp server %d: domain or hosts must be set", index)
+	}
+	if server.Port <= 0 || server.Port > 65535 {
+		return fmt.Errorf("smtp server %d: invalid port number: %d", index, server.Port)
+	}
+	if server.Helo == "" {
+		return fmt.Errorf("smtp server %d: helo cannot be empty", index)
+	}
+	if server.MailFrom == "" {
+		return fmt.Errorf("smtp server %d: mail_from cannot be empty", index)
+	}
+	if server.RcptTo == "" {
+		return fmt.Errorf("smtp server %d: rcpt_to cannot be empty", index)
+	}
+	return nil
+}
+
+func validateDAVServer(server DAVServerConfig, index int) error {
+	if server.Name == "" {
+		return fmt.Errorf("dav server %d: name cannot be empty", index)
+	}
+	if server.Type != "caldav" && server.Type != "carddav" {
+		return fmt.Errorf("dav server %d: type must be caldav or carddav", index)
+	}
+	if !strings.HasPrefix(server.BaseURL, "http://") && !strings.HasPrefix(server.BaseURL, "https://") {
+		return fmt.Errorf("dav server %d: base_url must start with http:// or https://", index)
+	}
+	if server.Username == "" {
+		return fmt.Errorf("dav server %d: username cannot be empty", index)
+	}
+	if server.Password == "" {
+		return fmt.Errorf("dav server %d: password cannot be empty", index)
+	}
+	return nil
+}
+
+func validateSLOObjective(objective SLOObjectiveConfig, index int) error {
+	if objective.Name == "" {
+		return fmt.Errorf("slo objective %d: name cannot be empty", index)
+	}
+	switch objective.Kind {
+	case "imap", "webmail", "dns", "dnsbl", "smtp", "sieve", "dav", "autoconfig":
+	default:
+		return fmt.Errorf("slo objective %d: unknown kind %q", index, objective.Kind)
+	}
+	if objective.Target <= 0 || objective.Target >= 100 {
+		return fmt.Errorf("slo objective %d: target must be between 0 and 100", index)
+	}
+	if objective.WindowDays <= 0 {
+		return fmt.Errorf("slo objective %d: window_days must be positive", index)
+	}
+	return nil
+}
+
+func validateAlertRule(rule AlertRuleConfig, index int) error {
+	if rule.Name == "" {
+		return fmt.Errorf("alert rule %d: name cannot be empty", index)
+	}
+	switch rule.Kind {
+	case "", "imap", "webmail", "dns", "dnsbl", "smtp", "sieve", "dav", "autoconfig":
+	default:
+		return fmt.Errorf("alert rule %d: unknown kind %q", index, rule.Kind)
+	}
+	if rule.ForMinutes < 0 {
+		return fmt.Errorf("alert rule %d: for_minutes cannot be negative", index)
+	}
+	switch rule.Type {
+	case "consecutive_failures":
+		if rule.Failures <= 0 {
+			return fmt.Errorf("alert rule %d: failures must be positive", index)
+		}
+	case "step_duration":
+		if rule.Step == "" {
+			return fmt.Errorf("alert rule %d: step cannot be empty", index)
+		}
+		if rule.ThresholdSeconds <= 0 {
+			return fmt.Errorf("alert rule %d: threshold_seconds must be positive", index)
+		}
+	case "cert_expiry":
+		if rule.Days <= 0 {
+			return fmt.Errorf("alert rule %d: days must be positive", index)
+		}
+	default:
+		return fmt.Errorf("alert rule %d: unknown type %q", index, rule.Type)
+	}
+	return nil
+}
+
+func validateAlertNotifier(notifier AlertNotifierConfig, index int) error {
+	if notifier.Name == "" {
+		return fmt.Errorf("alert notifier %d: name cannot be empty", index)
+	}
+	switch notifier.Type {
+	case "webhook", "slack":
+		if notifier.URL == "" {
+			return fmt.Errorf("alert notifier %d: url cannot be empty", index)
+		}
+	case "email":
+		if notifier.Host == "" || notifier.Port == 0 {
+			return fmt.Errorf("alert notifier %d: host and port are required", index)
+		}
+		if notifier.From == "" || len(notifier.To) == 0 {
+			return fmt.Errorf("alert notifier %d: from and to are required", index)
+		}
+	default:
+		return fmt.Errorf("alert notifier %d: unknown type %q", index, notifier.Type)
+	}
+	return nil
+}
+
+func validatePushTarget(target PushTargetConfig, name string) error {
+	if target.URL == "" {
+		return nil
+	}
+	if target.Protocol != "http" && target.Protocol != "grpc" {
+		return fmt.Errorf("push %s: protocol must be http or grpc", name)
+	}
+	if target.BatchSize <= 0 {
+		return fmt.Errorf("push %s: batch_size must be positive", name)
+	}
+	if target.BufferDir == "" {
+		return fmt.Errorf("push %s: buffer_dir cannot be empty", name)
+	}
+	if target.MaxBufferMB <= 0 {
+		return fmt.Errorf("push %s: max_buffer_mb must be positive", name)
+	}
+	return nil
+}
+
+func validateAgent(cfg *Config) error {
+	switch {
+	case strings.HasPrefix(cfg.Agent.ControllerURL, "https://"):
+	case strings.HasPrefix(cfg.Agent.ControllerURL, "http://"):
+		if !cfg.Agent.Insecure {
+			return fmt.Errorf("agent controller_url must use https://, or set insecure to send the target credentials in cleartext")
+		}
+	default:
+		return fmt.Errorf("agent controller_url must start with https://")
+	}
+	if cfg.Agent.Token == "" {
+		return fmt.Errorf("agent token cannot be empty")
+	}
+	if cfg.Agent.PollIntervalSeconds <= 0 {
+		return fmt.Errorf("agent poll_interval_seconds must be positive")
+	}
+	if (cfg.Agent.CertFile == "") != (cfg.Agent.KeyFile == "") {
+		return fmt.Errorf("agent cert_file and key_file must be set together")
+	}
+	if len(cfg.Controller.Agents) > 0 {
+		return fmt.Errorf("an agent cannot be a controller as well")
+	}
+	if len(cfg.IMAP.Servers) > 0 || len(cfg.Webmail.Servers) > 0 || len(cfg.DNS.Domains) > 0 ||
+		len(cfg.DNS.DNSBL.IPs) > 0 || len(cfg.SMTP.Servers) > 0 || len(cfg.Sieve.Servers) > 0 ||
+		len(cfg.DAV.Servers) > 0 || len(cfg.Autoconfig.Domains) > 0 {
+		return fmt.Errorf("an agent takes its targets from the controller; remove the local targets")
+	}
+	return nil
+}
+
+func validateAgentLocation(agent AgentLocationConfig, index int) error {
+	if agent.Location == "" {
+		return fmt.Errorf("controller agent %d: location cannot be empty", index)
+	}
+	if agent.Token == "" {
+		return fmt.Errorf("controller agent %d: token cannot be empty", index)
+	}
+	for j, target := range agent.Targets {
+		switch target.Kind {
+		case "imap", "webmail", "dns", "dnsbl", "smtp", "sieve", "dav", "autoconfig":
+		default:
+			return fmt.Errorf("controller agent %d: target %d: unknown kind %q", index, j, target.Kind)
+		}
+	}
+	return nil
+}
+
+func validateLogging(logging LoggingConfig) error {
+	if logging.Format != "text" && logging.Format != "json" {
+		return fmt.Errorf("logging format must be text or json")
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logging.Level)); err != nil {
+		return fmt.Errorf("logging level: %w", err)
+	}
+	for name, value := range logging.Levels {
+		switch name {
+		case "cmd", "imap", "webmail", "dav", "dns", "smtp", "sieve", "autoconfig",
+			"alert", "push", "fleet", "history", "slo", "results":
+		default:
+			return fmt.Errorf("logging levels: unknown package %q", name)
+		}
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("logging levels: %s: %w", name, err)
+		}
+	}
 	return nil
 }
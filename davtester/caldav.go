@@ -0,0 +1,50 @@
+package davtester
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+)
+
+var calendars = collectionType{
+	name:         "calendar",
+	homeSetBody:  propfindCalendarHome,
+	homeSet:      func(p prop) *href { return p.CalendarHomeSet },
+	isCollection: func(p prop) bool { return p.ResourceType.Calendar != nil },
+	query:        calendarRangeQuery,
+	resource: func(uid string) (string, string, string) {
+		return "text/calendar; charset=utf-8", testEvent(uid), ".ics"
+	},
+}
+
+func NewCalDAVTester(cfg config.DAVServerConfig) DAVTester {
+	return newTester(cfg, calendars)
+}
+
+func init() {
+	Register("caldav", NewCalDAVTester)
+}
+
+// calendarRangeQuery queries the events from a week ago to a month ahead.
+func calendarRangeQuery() string {
+	const layout = "20060102T150405Z"
+	now := time.Now().UTC()
+	return fmt.Sprintf(calendarQuery, now.AddDate(0, 0, -7).Format(layout), now.AddDate(0, 1, 0).Format(layout))
+}
+
+func testEvent(uid string) string {
+	const layout = "20060102T150405Z"
+	now := time.Now().UTC()
+	return "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"PRODID:-//mailmetrix//EN\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:" + uid + "\r\n" +
+		"DTSTAMP:" + now.Format(layout) + "\r\n" +
+		"DTSTART:" + now.Add(time.Hour).Format(layout) + "\r\n" +
+		"DTEND:" + now.Add(2*time.Hour).Format(layout) + "\r\n" +
+		"SUMMARY:mailmetrix-test\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+}
@@ -0,0 +1,33 @@
+package davtester
+
+import (
+	"github.com/dniminenn/mailmetrix/config"
+)
+
+var addressBooks = collectionType{
+	name:         "addressbook",
+	homeSetBody:  propfindAddressbookHome,
+	homeSet:      func(p prop) *href { return p.AddressbookHomeSet },
+	isCollection: func(p prop) bool { return p.ResourceType.Addressbook != nil },
+	query:        func() string { return addressbookQuery },
+	resource: func(uid string) (string, string, string) {
+		return "text/vcard; charset=utf-8", testContact(uid), ".vcf"
+	},
+}
+
+func NewCardDAVTester(cfg config.DAVServerConfig) DAVTester {
+	return newTester(cfg, addressBooks)
+}
+
+func init() {
+	Register("carddav", NewCardDAVTester)
+}
+
+func testContact(uid string) string {
+	return "BEGIN:VCARD\r\n" +
+		"VERSION:3.0\r\n" +
+		"UID:" + uid + "\r\n" +
+		"FN:mailmetrix-test\r\n" +
+		"N:test;mailmetrix;;;\r\n" +
+		"END:VCARD\r\n"
+}
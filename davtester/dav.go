@@ -0,0 +1,338 @@
+package davtester
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/errclass"
+	"github.com/dniminenn/mailmetrix/results"
+	"github.com/dniminenn/mailmetrix/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type DAVTester interface {
+	RunSession(context.Context) error
+	GetName() string
+}
+
+var testers = make(map[string]func(cfg config.DAVServerConfig) DAVTester)
+
+func Register(name string, factory func(cfg config.DAVServerConfig) DAVTester) {
+	testers[name] = factory
+}
+
+func NewDAVTester(cfg config.DAVServerConfig) (DAVTester, error) {
+	factory, ok := testers[cfg.Type]
+	if !ok {
+		return nil, fmt.Errorf("no dav tester found for type: %s", cfg.Type)
+	}
+	return tracedTester{DAVTester: factory(cfg), cfg: cfg}, nil
+}
+
+// collectionType holds what differs between CalDAV and CardDAV: the home set property,
+// the collection resource type, the REPORT query and the test resource.
+type collectionType struct {
+	name         string
+	homeSetBody  string
+	homeSet      func(prop) *href
+	isCollection func(prop) bool
+	// query returns the body of the REPORT on a collection.
+	query func() string
+	// resource returns the content type, body and file extension of a test resource.
+	resource func(uid string) (contentType, body, ext string)
+}
+
+// Tester checks a CalDAV or CardDAV server: principal and home discovery, a REPORT query
+// on the first collection and optionally creating and deleting a test resource.
+type Tester struct {
+	cfg    config.DAVServerConfig
+	kind   collectionType
+	client *http.Client
+}
+
+func (t *Tester) GetName() string {
+	return t.cfg.Name
+}
+
+func newTester(cfg config.DAVServerConfig, kind collectionType) *Tester {
+	return &Tester{
+		cfg:  cfg,
+		kind: kind,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: tracing.Transport{RoundTripper: http.DefaultTransport, Tracer: tracer},
+		},
+	}
+}
+
+// observe sets the timing gauge of a successful operation and records it in the session.
+func (t *Tester) observe(ctx context.Context, gauge *prometheus.GaugeVec, operation string, d time.Duration) {
+	gauge.WithLabelValues(t.cfg.Name).Set(d.Seconds())
+	results.FromContext(ctx).Step(operation, d)
+	loggerFrom(ctx, t.cfg.Name).Debug("Operation succeeded", "operation", operation, "duration", d)
+}
+
+// If we don't clean up stale metrics, Prometheus will keep reporting the last value indefinitely.
+func (t *Tester) handleFailure(ctx context.Context, operation string, err error) {
+	reason := errclass.Classify(err)
+	loggerFrom(ctx, t.cfg.Name).Error("Operation failed", "operation", operation, "error_class", reason, "error", err)
+	davFailures.WithLabelValues(t.cfg.Name, operation, reason).Inc()
+
+	tracing.Fail(trace.SpanFromContext(ctx), reason, err)
+	session := results.FromContext(ctx)
+	session.Fail(operation, reason, err)
+	var statusErr *errclass.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		session.Snippet(fmt.Sprintf("HTTP %d: %s", statusErr.StatusCode, statusErr.Body))
+	}
+	t.resetMetricsForOperation(operation)
+}
+
+func (t *Tester) resetMetricsForOperation(operation string) {
+	switch operation {
+	case "principal":
+		timeToPrincipal.WithLabelValues(t.cfg.Name).Set(math.NaN())
+	case "home":
+		timeToHome.WithLabelValues(t.cfg.Name).Set(math.NaN())
+	case "report":
+		timeToReport.WithLabelValues(t.cfg.Name).Set(math.NaN())
+	case "put":
+		timeToPut.WithLabelValues(t.cfg.Name).Set(math.NaN())
+	case "delete":
+		timeToDelete.WithLabelValues(t.cfg.Name).Set(math.NaN())
+	}
+}
+
+// RunSession runs the DAV test session.
+func (t *Tester) RunSession(ctx context.Context) error {
+	var principal, collection *url.URL
+
+	err := traced(ctx, "principal", func(ctx context.Context) error {
+		start := time.Now()
+		var err error
+		if principal, err = t.discoverPrincipal(ctx); err != nil {
+			t.handleFailure(ctx, "principal", err)
+			return fmt.Errorf("principal discovery failed: %w", err)
+		}
+		t.observe(ctx, timeToPrincipal, "principal", time.Since(start))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = traced(ctx, "home", func(ctx context.Context) error {
+		start := time.Now()
+		var err error
+		if collection, err = t.discoverCollection(ctx, principal); err != nil {
+			t.handleFailure(ctx, "home", err)
+			return fmt.Errorf("home discovery failed: %w", err)
+		}
+		t.observe(ctx, timeToHome, "home", time.Since(start))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = traced(ctx, "report", func(ctx context.Context) error {
+		start := time.Now()
+		if err := t.report(ctx, collection); err != nil {
+			t.handleFailure(ctx, "report", err)
+			return fmt.Errorf("report failed: %w", err)
+		}
+		t.observe(ctx, timeToReport, "report", time.Since(start))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if t.cfg.WriteTest {
+		return t.writeTest(ctx, collection)
+	}
+	return nil
+}
+
+// discoverPrincipal asks the base URL for the current user principal.
+func (t *Tester) discoverPrincipal(ctx context.Context) (*url.URL, error) {
+	base, err := url.Parse(t.cfg.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+
+	ms, err := t.propfind(ctx, base, "0", propfindPrincipal)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range ms.Responses {
+		for _, p := range r.okProps() {
+			if p.CurrentUserPrincipal != nil && p.CurrentUserPrincipal.Href != "" {
+				return resolve(base, p.CurrentUserPrincipal.Href)
+			}
+		}
+	}
+	return nil, errclass.Errorf(errclass.UnexpectedContent, "server did not return current-user-principal")
+}
+
+// discoverCollection finds the calendar or address book home of the principal and returns
+// its first calendar or address book collection.
+func (t *Tester) discoverCollection(ctx context.Context, principal *url.URL) (*url.URL, error) {
+	ms, err := t.propfind(ctx, principal, "0", t.kind.homeSetBody)
+	if err != nil {
+		return nil, err
+	}
+	var home *url.URL
+	for _, r := range ms.Responses {
+		for _, p := range r.okProps() {
+			if set := t.kind.homeSet(p); set != nil && set.Href != "" {
+				if home, err = resolve(principal, set.Href); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if home == nil {
+		return nil, errclass.Errorf(errclass.UnexpectedContent, "server did not return a %s home set", t.kind.name)
+	}
+
+	ms, err = t.propfind(ctx, home, "1", propfindResourceType)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range ms.Responses {
+		for _, p := range r.okProps() {
+			if t.kind.isCollection(p) {
+				return resolve(home, r.Href)
+			}
+		}
+	}
+	return nil, errclass.Errorf(errclass.UnexpectedContent, "no collection found in %s", home)
+}
+
+// report runs the REPORT query of the collection type on the collection.
+func (t *Tester) report(ctx context.Context, collection *url.URL) error {
+	resp, err := t.do(ctx, "REPORT", collection, "1", "application/xml; charset=utf-8", t.kind.query())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return unexpectedStatus(resp)
+	}
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return fmt.Errorf("failed to parse report response: %w", err)
+	}
+	return nil
+}
+
+// writeTest creates a test event or contact in the collection and deletes it again.
+func (t *Tester) writeTest(ctx context.Context, collection *url.URL) error {
+	uid := fmt.Sprintf("mailmetrix-%d", time.Now().UnixNano())
+	contentType, body, ext := t.kind.resource(uid)
+	resource, err := resolve(collection, uid+ext)
+	if err != nil {
+		return err
+	}
+
+	err = traced(ctx, "put", func(ctx context.Context) error {
+		start := time.Now()
+		resp, err := t.do(ctx, "PUT", resource, "", contentType, body)
+		if err == nil {
+			if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+				err = unexpectedStatus(resp)
+			}
+			resp.Body.Close()
+		}
+		if err != nil {
+			t.handleFailure(ctx, "put", err)
+			return fmt.Errorf("put failed: %w", err)
+		}
+		t.observe(ctx, timeToPut, "put", time.Since(start))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return traced(ctx, "delete", func(ctx context.Context) error {
+		start := time.Now()
+		resp, err := t.do(ctx, "DELETE", resource, "", "", "")
+		if err == nil {
+			if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+				err = unexpectedStatus(resp)
+			}
+			resp.Body.Close()
+		}
+		if err != nil {
+			t.handleFailure(ctx, "delete", err)
+			return fmt.Errorf("delete failed: %w", err)
+		}
+		t.observe(ctx, timeToDelete, "delete", time.Since(start))
+		return nil
+	})
+}
+
+func (t *Tester) propfind(ctx context.Context, target *url.URL, depth, body string) (*multistatus, error) {
+	resp, err := t.do(ctx, "PROPFIND", target, depth, "application/xml; charset=utf-8", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, unexpectedStatus(resp)
+	}
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("failed to parse propfind response: %w", err)
+	}
+	return &ms, nil
+}
+
+func (t *Tester) do(ctx context.Context, method string, target *url.URL, depth, contentType, body string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", method, err)
+	}
+	req.SetBasicAuth(t.cfg.Username, t.cfg.Password)
+	if depth != "" {
+		req.Header.Set("Depth", depth)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if t.cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", t.cfg.UserAgent)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", method, err)
+	}
+	return resp, nil
+}
+
+func resolve(base *url.URL, ref string) (*url.URL, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, errclass.Errorf(errclass.UnexpectedContent, "invalid href %q: %w", ref, err)
+	}
+	return base.ResolveReference(u), nil
+}
+
+func unexpectedStatus(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return &errclass.HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+}
@@ -0,0 +1,78 @@
+package davtester
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	timeToPrincipal = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "dav_time_to_principal_seconds",
+			Help:      "Time to discover the current user principal",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server"},
+	)
+	timeToHome = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "dav_time_to_home_seconds",
+			Help:      "Time to discover the calendar or address book home and its collections",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server"},
+	)
+	timeToReport = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "dav_time_to_report_seconds",
+			Help:      "Time to run a REPORT query on the first collection",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server"},
+	)
+	timeToPut = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "dav_time_to_put_seconds",
+			Help:      "Time to create a test event or contact",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server"},
+	)
+	timeToDelete = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "dav_time_to_delete_seconds",
+			Help:      "Time to delete a test event or contact",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server"},
+	)
+	davFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "dav_failures_total",
+			Help:      "Total number of DAV operation failures by reason",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "operation", "reason"},
+	)
+)
+
+func init() {
+	metrics := []prometheus.Collector{
+		timeToPrincipal,
+		timeToHome,
+		timeToReport,
+		timeToPut,
+		timeToDelete,
+		davFailures,
+	}
+
+	for _, metric := range metrics {
+		if err := prometheus.Register(metric); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				prometheus.Unregister(are.ExistingCollector)
+				prometheus.MustRegister(metric)
+			} else {
+				logger.Error("Error registering metric", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package davtester
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+type href struct {
+	Href string `xml:"DAV: href"`
+}
+
+type prop struct {
+	CurrentUserPrincipal *href `xml:"DAV: current-user-principal"`
+	CalendarHomeSet      *href `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+	AddressbookHomeSet   *href `xml:"urn:ietf:params:xml:ns:carddav addressbook-home-set"`
+	ResourceType         struct {
+		Calendar    *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+		Addressbook *struct{} `xml:"urn:ietf:params:xml:ns:carddav addressbook"`
+	} `xml:"DAV: resourcetype"`
+}
+
+type propstat struct {
+	Prop   prop   `xml:"DAV: prop"`
+	Status string `xml:"DAV: status"`
+}
+
+type response struct {
+	Href     string     `xml:"DAV: href"`
+	Propstat []propstat `xml:"DAV: propstat"`
+}
+
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"DAV: response"`
+}
+
+// okProps returns the properties of the propstat blocks with a 2xx status.
+func (r response) okProps() []prop {
+	var props []prop
+	for _, ps := range r.Propstat {
+		fields := strings.Fields(ps.Status)
+		if len(fields) >= 2 && strings.HasPrefix(fields[1], "2") {
+			props = append(props, ps.Prop)
+		}
+	}
+	return props
+}
+
+const propfindPrincipal = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:current-user-principal/></d:prop></d:propfind>`
+
+const propfindCalendarHome = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><c:calendar-home-set/></d:prop></d:propfind>`
+
+const propfindAddressbookHome = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:carddav"><d:prop><c:addressbook-home-set/></d:prop></d:propfind>`
+
+const propfindResourceType = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/></d:prop></d:propfind>`
+
+// calendarQuery is an RFC 4791 time-range query; the range is filled in with UTC timestamps.
+const calendarQuery = `<?xml version="1.0" encoding="utf-8"?>
+<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/></d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VEVENT">
+        <c:time-range start="%s" end="%s"/>
+      </c:comp-filter>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>`
+
+const addressbookQuery = `<?xml version="1.0" encoding="utf-8"?>
+<c:addressbook-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:carddav">
+  <d:prop><d:getetag/></d:prop>
+  <c:filter><c:prop-filter name="FN"/></c:filter>
+</c:addressbook-query>`
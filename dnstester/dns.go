@@ -0,0 +1,255 @@
+package dnstester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/errclass"
+)
+
+// Tester checks the mail-related DNS records of a single domain.
+type Tester struct {
+	cfg      config.DNSDomainConfig
+	resolver *net.Resolver
+	client   *http.Client
+}
+
+func (t *Tester) GetName() string {
+	return t.cfg.Domain
+}
+
+// NewTester creates a tester querying the DNS server at resolverAddress, or the system
+// resolver if it is empty.
+func NewTester(cfg config.DNSDomainConfig, resolverAddress string) *Tester {
+	resolver := NewResolver(resolverAddress)
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Resolver: resolver}
+	return &Tester{
+		cfg:      cfg,
+		resolver: resolver,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+		},
+	}
+}
+
+// NewResolver returns a resolver that sends every query to address (host:port),
+// or the system resolver if address is empty.
+func NewResolver(address string) *net.Resolver {
+	if address == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, address)
+		},
+	}
+}
+
+func (t *Tester) handleFailure(record, name string, err error) {
+	t.log().Error("Lookup failed", "operation", record, "name", name, "error_class", errclass.Classify(err), "error", err)
+	dnsFailures.WithLabelValues(t.cfg.Domain, record, name).Inc()
+	lookupTime.WithLabelValues(t.cfg.Domain, record, name).Set(math.NaN())
+	recordPresent.WithLabelValues(t.cfg.Domain, record, name).Set(math.NaN())
+	recordValid.WithLabelValues(t.cfg.Domain, record, name).Set(math.NaN())
+}
+
+// RunSession checks every record of the domain. Missing optional records only update the
+// presence metrics; lookup failures and missing or invalid required records are returned.
+func (t *Tester) RunSession(ctx context.Context) error {
+	domain := strings.TrimSuffix(t.cfg.Domain, ".")
+
+	errs := []error{
+		t.checkMX(ctx, domain),
+		t.checkTXT(ctx, "spf", domain, "v=spf1", validateSPF, true),
+		t.checkTXT(ctx, "dmarc", "_dmarc."+domain, "v=DMARC1", validateDMARC, true),
+		t.checkTXT(ctx, "tlsrpt", "_smtp._tls."+domain, "v=TLSRPTv1", validateTLSRPT, false),
+	}
+	for _, selector := range t.cfg.DKIMSelectors {
+		errs = append(errs, t.checkTXT(ctx, "dkim", selector+"._domainkey."+domain, "", validateDKIM, true))
+	}
+	errs = append(errs, t.checkMTASTS(ctx, domain))
+
+	return errors.Join(errs...)
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// setResult records presence and validity of a record that was looked up successfully.
+func (t *Tester) setResult(record, name string, present bool, validErr error) {
+	recordPresent.WithLabelValues(t.cfg.Domain, record, name).Set(boolToFloat(present))
+	recordValid.WithLabelValues(t.cfg.Domain, record, name).Set(boolToFloat(present && validErr == nil))
+}
+
+func (t *Tester) checkMX(ctx context.Context, domain string) error {
+	start := time.Now()
+	mxs, err := t.resolver.LookupMX(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		t.handleFailure("mx", domain, err)
+		return fmt.Errorf("mx lookup for %s failed: %w", domain, err)
+	}
+	lookupTime.WithLabelValues(t.cfg.Domain, "mx", domain).Set(time.Since(start).Seconds())
+
+	if len(mxs) == 0 {
+		t.setResult("mx", domain, false, nil)
+		return fmt.Errorf("no mx record found at %s", domain)
+	}
+
+	hosts := make([]string, 0, len(mxs))
+	var validErr error
+	for _, mx := range mxs {
+		host := normalizeHost(mx.Host)
+		if host == "" {
+			validErr = fmt.Errorf("null mx record at %s", domain)
+		}
+		hosts = append(hosts, host)
+	}
+	t.setResult("mx", domain, true, validErr)
+
+	if len(t.cfg.ExpectedMX) > 0 {
+		expected := make([]string, 0, len(t.cfg.ExpectedMX))
+		for _, host := range t.cfg.ExpectedMX {
+			expected = append(expected, normalizeHost(host))
+		}
+		slices.Sort(expected)
+		got := slices.Clone(hosts)
+		slices.Sort(got)
+
+		if !slices.Equal(slices.Compact(expected), slices.Compact(got)) {
+			mxExpectedMatch.WithLabelValues(t.cfg.Domain).Set(0)
+			return errors.Join(validErr, fmt.Errorf("mx hosts %v do not match expected %v", got, expected))
+		}
+		mxExpectedMatch.WithLabelValues(t.cfg.Domain).Set(1)
+	}
+
+	return validErr
+}
+
+// checkTXT is lookupTXT for callers that only need the outcome.
+func (t *Tester) checkTXT(ctx context.Context, record, name, prefix string, validate func(string) error, required bool) error {
+	_, err := t.lookupTXT(ctx, record, name, prefix, validate, required)
+	return err
+}
+
+// lookupTXT looks up the TXT records at name and validates the one starting with prefix.
+// More than one matching record is invalid, as SPF, DMARC and friends require exactly one.
+func (t *Tester) lookupTXT(ctx context.Context, record, name, prefix string, validate func(string) error, required bool) (string, error) {
+	start := time.Now()
+	txts, err := t.resolver.LookupTXT(ctx, name)
+	if err != nil && !isNotFound(err) {
+		t.handleFailure(record, name, err)
+		return "", fmt.Errorf("%s lookup for %s failed: %w", record, name, err)
+	}
+	lookupTime.WithLabelValues(t.cfg.Domain, record, name).Set(time.Since(start).Seconds())
+
+	var matches []string
+	for _, txt := range txts {
+		if hasTagPrefix(txt, prefix) {
+			matches = append(matches, txt)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		t.setResult(record, name, false, nil)
+		if required {
+			return "", fmt.Errorf("no %s record found at %s", record, name)
+		}
+		return "", nil
+	case 1:
+		validErr := validate(matches[0])
+		t.setResult(record, name, true, validErr)
+		if validErr != nil {
+			return "", fmt.Errorf("invalid %s record at %s: %w", record, name, validErr)
+		}
+		return matches[0], nil
+	default:
+		err := fmt.Errorf("%d %s records found at %s, expected one", len(matches), record, name)
+		t.setResult(record, name, true, err)
+		return "", err
+	}
+}
+
+// checkMTASTS validates the MTA-STS TXT record and, if it is present, fetches the policy
+// and checks that every MX host is covered by it.
+func (t *Tester) checkMTASTS(ctx context.Context, domain string) error {
+	txt, err := t.lookupTXT(ctx, "mta_sts", "_mta-sts."+domain, "v=STSv1", validateSTSRecord, false)
+	if err != nil || txt == "" {
+		return err
+	}
+
+	policyURL := fmt.Sprintf("https://mta-sts.%s/.well-known/mta-sts.txt", domain)
+	start := time.Now()
+	policy, err := t.fetchPolicy(ctx, policyURL)
+	if err != nil {
+		t.handleFailure("mta_sts_policy", policyURL, err)
+		return fmt.Errorf("mta-sts policy fetch for %s failed: %w", domain, err)
+	}
+	lookupTime.WithLabelValues(t.cfg.Domain, "mta_sts_policy", policyURL).Set(time.Since(start).Seconds())
+
+	parsed, validErr := parseSTSPolicy(policy)
+	if validErr == nil && parsed.mode != "none" {
+		mxs, err := t.resolver.LookupMX(ctx, domain)
+		if err == nil {
+			for _, mx := range mxs {
+				if !parsed.matches(normalizeHost(mx.Host)) {
+					validErr = fmt.Errorf("mx host %s is not covered by the policy", normalizeHost(mx.Host))
+					break
+				}
+			}
+		}
+	}
+	t.setResult("mta_sts_policy", policyURL, true, validErr)
+	if validErr != nil {
+		return fmt.Errorf("invalid mta-sts policy for %s: %w", domain, validErr)
+	}
+	return nil
+}
+
+func (t *Tester) fetchPolicy(ctx context.Context, policyURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", policyURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create policy request: %w", err)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("policy request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("policy request failed with status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read policy: %w", err)
+	}
+	return string(body), nil
+}
+
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
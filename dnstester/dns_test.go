@@ -0,0 +1,213 @@
+package dnstester
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/dniminenn/mailmetrix/config"
+)
+
+// stubZone answers TXT, MX and A queries from memory; other names are NXDOMAIN.
+type stubZone struct {
+	txt map[string][]string
+	mx  map[string][]string
+	a   map[string][]string
+}
+
+// serveStub starts a UDP DNS server for the zone and returns its address.
+func serveStub(t *testing.T, zone stubZone) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp, err := zone.answer(buf[:n]); err == nil {
+				conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func (z stubZone) answer(query []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(q.Name.String(), "."))
+	_, hasTXT := z.txt[name]
+	_, hasMX := z.mx[name]
+	_, hasA := z.a[name]
+	rcode := dnsmessage.RCodeSuccess
+	if !hasTXT && !hasMX && !hasA {
+		rcode = dnsmessage.RCodeNameError
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 header.ID,
+		Response:           true,
+		Authoritative:      true,
+		RecursionDesired:   header.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              rcode,
+	})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	rr := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	switch q.Type {
+	case dnsmessage.TypeTXT:
+		for _, txt := range z.txt[name] {
+			if err := b.TXTResource(rr, dnsmessage.TXTResource{TXT: []string{txt}}); err != nil {
+				return nil, err
+			}
+		}
+	case dnsmessage.TypeMX:
+		for i, host := range z.mx[name] {
+			mx := dnsmessage.MustNewName(host + ".")
+			if err := b.MXResource(rr, dnsmessage.MXResource{Pref: uint16(10 * (i + 1)), MX: mx}); err != nil {
+				return nil, err
+			}
+		}
+	case dnsmessage.TypeA:
+		for _, addr := range z.a[name] {
+			if err := b.AResource(rr, dnsmessage.AResource{A: [4]byte(net.ParseIP(addr).To4())}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
+
+func TestRunSessionWithResolver(t *testing.T) {
+	healthy := stubZone{
+		txt: map[string][]string{
+			"example.com":                 {"v=spf1 mx include:_spf.example.net -all", "google-site-verification=abc"},
+			"_dmarc.example.com":          {"v=DMARC1; p=reject; rua=mailto:dmarc@example.com"},
+			"_smtp._tls.example.com":      {"v=TLSRPTv1; rua=mailto:tlsrpt@example.com"},
+			"mail._domainkey.example.com": {"v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQCw"},
+			"_spf.example.net":            {"v=spf1 ip4:192.0.2.0/24 -all"},
+		},
+		mx: map[string][]string{
+			"example.com": {"mx1.example.com", "mx2.example.com"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		zone    stubZone
+		cfg     config.DNSDomainConfig
+		wantErr string
+	}{
+		{
+			name: "healthy",
+			zone: healthy,
+			cfg: config.DNSDomainConfig{
+				Domain:        "example.com",
+				ExpectedMX:    []string{"MX2.example.com.", "mx1.example.com"},
+				DKIMSelectors: []string{"mail"},
+			},
+		},
+		{
+			name:    "unexpected mx",
+			zone:    healthy,
+			cfg:     config.DNSDomainConfig{Domain: "example.com", ExpectedMX: []string{"mx1.example.com"}},
+			wantErr: "do not match expected",
+		},
+		{
+			name:    "missing dkim selector",
+			zone:    healthy,
+			cfg:     config.DNSDomainConfig{Domain: "example.com", DKIMSelectors: []string{"missing"}},
+			wantErr: "no dkim record found at missing._domainkey.example.com",
+		},
+		{
+			name: "duplicate spf",
+			zone: stubZone{
+				txt: map[string][]string{
+					"example.com":        {"v=spf1 -all", "v=spf1 mx -all"},
+					"_dmarc.example.com": {"v=DMARC1; p=none"},
+				},
+				mx: healthy.mx,
+			},
+			cfg:     config.DNSDomainConfig{Domain: "example.com"},
+			wantErr: "2 spf records found",
+		},
+		{
+			name: "invalid dmarc",
+			zone: stubZone{
+				txt: map[string][]string{
+					"example.com":        {"v=spf1 -all"},
+					"_dmarc.example.com": {"v=DMARC1; p=block"},
+				},
+				mx: healthy.mx,
+			},
+			cfg:     config.DNSDomainConfig{Domain: "example.com"},
+			wantErr: "invalid dmarc record",
+		},
+		{
+			name:    "missing domain",
+			zone:    healthy,
+			cfg:     config.DNSDomainConfig{Domain: "missing.example.org"},
+			wantErr: "no mx record found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tester := NewTester(tt.cfg, serveStub(t, tt.zone))
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			err := tester.RunSession(ctx)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("RunSession() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("RunSession() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewResolverUsesAddress(t *testing.T) {
+	address := serveStub(t, stubZone{txt: map[string][]string{"probe.test": {"from the stub"}}})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	txts, err := NewResolver(address).LookupTXT(ctx, "probe.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txts) != 1 || txts[0] != "from the stub" {
+		t.Errorf("LookupTXT() = %v, want [from the stub]", txts)
+	}
+}
@@ -0,0 +1,145 @@
+package dnstester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/errclass"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DNSBLTester checks a single sending IP against a list of DNSBL zones.
+type DNSBLTester struct {
+	ip       string
+	zones    []string
+	resolver *net.Resolver
+}
+
+func (t *DNSBLTester) GetName() string {
+	return t.ip
+}
+
+// NewDNSBLTester creates a tester querying the DNS server at resolverAddress, or the
+// system resolver if it is empty.
+func NewDNSBLTester(ip string, zones []string, resolverAddress string) *DNSBLTester {
+	return &DNSBLTester{
+		ip:       ip,
+		zones:    zones,
+		resolver: NewResolver(resolverAddress),
+	}
+}
+
+func (t *DNSBLTester) handleFailure(zone string, err error) {
+	t.log().Error("Query failed", "zone", zone, "error_class", errclass.Classify(err), "error", err)
+	dnsblFailures.WithLabelValues(t.ip, zone).Inc()
+	dnsblLookupTime.WithLabelValues(t.ip, zone).Set(math.NaN())
+	dnsblListed.DeletePartialMatch(prometheus.Labels{"ip": t.ip, "zone": zone})
+}
+
+// RunSession queries every zone. Listings are reported through the metrics only;
+// the returned error covers queries that could not be answered.
+func (t *DNSBLTester) RunSession(ctx context.Context) error {
+	name, err := reverseIP(t.ip)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, zone := range t.zones {
+		if err := t.checkZone(ctx, name, strings.TrimSuffix(zone, ".")); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *DNSBLTester) checkZone(ctx context.Context, name, zone string) error {
+	start := time.Now()
+	addrs, err := t.resolver.LookupHost(ctx, name+"."+zone)
+	if err != nil && !isNotFound(err) {
+		t.handleFailure(zone, err)
+		return fmt.Errorf("%s lookup failed: %w", zone, err)
+	}
+	elapsed := time.Since(start)
+
+	var codes []string
+	for _, addr := range addrs {
+		code, err := decodeDNSBLCode(zone, addr)
+		if err != nil {
+			t.handleFailure(zone, err)
+			return fmt.Errorf("%s: %w", zone, err)
+		}
+		codes = append(codes, code)
+	}
+
+	dnsblLookupTime.WithLabelValues(t.ip, zone).Set(elapsed.Seconds())
+	dnsblListed.DeletePartialMatch(prometheus.Labels{"ip": t.ip, "zone": zone})
+	if len(codes) == 0 {
+		dnsblListed.WithLabelValues(t.ip, zone, "").Set(0)
+		return nil
+	}
+	for _, code := range codes {
+		dnsblListed.WithLabelValues(t.ip, zone, code).Set(1)
+	}
+	t.log().Warn("Listed on DNSBL", "zone", zone, "codes", strings.Join(codes, ", "))
+	return nil
+}
+
+// reverseIP returns the DNSBL query label for ip: reversed octets for IPv4 and
+// reversed nibbles for IPv6.
+func reverseIP(ip string) (string, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", fmt.Errorf("invalid ip address %q", ip)
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", v4[3], v4[2], v4[1], v4[0]), nil
+	}
+
+	const hexDigits = "0123456789abcdef"
+	nibbles := make([]string, 0, 32)
+	for i := len(parsed) - 1; i >= 0; i-- {
+		nibbles = append(nibbles, string(hexDigits[parsed[i]&0x0f]), string(hexDigits[parsed[i]>>4]))
+	}
+	return strings.Join(nibbles, "."), nil
+}
+
+// spamhausCodes decodes the Spamhaus ZEN return codes into the list that matched.
+var spamhausCodes = map[string]string{
+	"127.0.0.2":  "sbl",
+	"127.0.0.3":  "sbl_css",
+	"127.0.0.4":  "xbl",
+	"127.0.0.5":  "xbl",
+	"127.0.0.6":  "xbl",
+	"127.0.0.7":  "xbl",
+	"127.0.0.9":  "drop",
+	"127.0.0.10": "pbl_isp",
+	"127.0.0.11": "pbl_spamhaus",
+}
+
+// decodeDNSBLCode maps a DNSBL answer to a code label. Answers outside 127.0.0.0/8 and the
+// Spamhaus 127.255.255.0/24 error range mean the query itself was rejected, not a listing.
+func decodeDNSBLCode(zone, addr string) (string, error) {
+	if strings.HasPrefix(addr, "127.255.255.") {
+		return "", fmt.Errorf("query refused by list operator (%s)", addr)
+	}
+	if !strings.HasPrefix(addr, "127.") {
+		return "", fmt.Errorf("unexpected answer %s, resolver may be hijacking NXDOMAIN", addr)
+	}
+
+	if strings.HasSuffix(zone, "spamhaus.org") {
+		if code, ok := spamhausCodes[addr]; ok {
+			return code, nil
+		}
+	}
+	if addr == "127.0.0.2" {
+		return "listed", nil
+	}
+	return addr, nil
+}
@@ -0,0 +1,110 @@
+package dnstester
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReverseIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		want    string
+		wantErr bool
+	}{
+		{"192.0.2.1", "1.2.0.192", false},
+		{"127.0.0.2", "2.0.0.127", false},
+		{"::ffff:192.0.2.1", "1.2.0.192", false},
+		{"2001:db8::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2", false},
+		{"2001:DB8:1234:5678:9abc:def0:1:2", "2.0.0.0.1.0.0.0.0.f.e.d.c.b.a.9.8.7.6.5.4.3.2.1.8.b.d.0.1.0.0.2", false},
+		{"192.0.2", "", true},
+		{"mail.example.com", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := reverseIP(tt.ip)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("reverseIP(%q) = %q, %v, want %q, error %v", tt.ip, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDecodeDNSBLCode(t *testing.T) {
+	tests := []struct {
+		zone    string
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{"zen.spamhaus.org", "127.0.0.2", "sbl", false},
+		{"zen.spamhaus.org", "127.0.0.3", "sbl_css", false},
+		{"zen.spamhaus.org", "127.0.0.4", "xbl", false},
+		{"zen.spamhaus.org", "127.0.0.7", "xbl", false},
+		{"zen.spamhaus.org", "127.0.0.9", "drop", false},
+		{"zen.spamhaus.org", "127.0.0.10", "pbl_isp", false},
+		{"zen.spamhaus.org", "127.0.0.11", "pbl_spamhaus", false},
+		{"sbl.spamhaus.org", "127.0.0.2", "sbl", false},
+		{"zen.spamhaus.org", "127.0.0.8", "127.0.0.8", false},
+		{"zen.spamhaus.org", "127.255.255.254", "", true},
+		{"zen.spamhaus.org", "127.255.255.252", "", true},
+		{"bl.spamcop.net", "127.0.0.2", "listed", false},
+		{"b.barracudacentral.org", "127.0.0.4", "127.0.0.4", false},
+		{"bl.spamcop.net", "198.51.100.7", "", true},
+	}
+	for _, tt := range tests {
+		got, err := decodeDNSBLCode(tt.zone, tt.addr)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("decodeDNSBLCode(%q, %q) = %q, %v, want %q, error %v", tt.zone, tt.addr, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDNSBLRunSession(t *testing.T) {
+	const ip = "192.0.2.99"
+	address := serveStub(t, stubZone{
+		a: map[string][]string{
+			// Listed on two Spamhaus lists.
+			"99.2.0.192.zen.spamhaus.org": {"127.0.0.2", "127.0.0.4"},
+			// The name exists without an A record, which is not a listing either.
+			"99.2.0.192.nodata.example.org":  {},
+			"99.2.0.192.refused.example.org": {"127.255.255.254"},
+		},
+		txt: map[string][]string{"99.2.0.192.nodata.example.org": {"not an address"}},
+	})
+	tester := NewDNSBLTester(ip, []string{"zen.spamhaus.org.", "bl.example.org", "nodata.example.org"}, address)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := tester.RunSession(ctx); err != nil {
+		t.Fatalf("RunSession() = %v", err)
+	}
+	listed := []struct {
+		zone, code string
+		want       float64
+	}{
+		{"zen.spamhaus.org", "sbl", 1},
+		{"zen.spamhaus.org", "xbl", 1},
+		{"bl.example.org", "", 0},
+		{"nodata.example.org", "", 0},
+	}
+	for _, l := range listed {
+		if got := testutil.ToFloat64(dnsblListed.WithLabelValues(ip, l.zone, l.code)); got != l.want {
+			t.Errorf("dnsbl_listed{zone=%q,code=%q} = %v, want %v", l.zone, l.code, got, l.want)
+		}
+	}
+	if n := testutil.CollectAndCount(dnsblListed); n != len(listed) {
+		t.Errorf("%d dnsbl_listed series, want %d", n, len(listed))
+	}
+
+	refused := NewDNSBLTester(ip, []string{"refused.example.org"}, address)
+	err := refused.RunSession(ctx)
+	if err == nil || !strings.Contains(err.Error(), "query refused by list operator") {
+		t.Errorf("RunSession() = %v, want refused query error", err)
+	}
+	if got := testutil.ToFloat64(dnsblFailures.WithLabelValues(ip, "refused.example.org")); got != 1 {
+		t.Errorf("dnsbl_failures_total = %v, want 1", got)
+	}
+}
@@ -0,0 +1,19 @@
+package dnstester
+
+import (
+	"log/slog"
+
+	"github.com/dniminenn/mailmetrix/logging"
+)
+
+var logger = logging.New("dns")
+
+// log returns the logger with the attributes identifying this tester.
+func (t *Tester) log() *slog.Logger {
+	return logger.With("server", t.cfg.Domain, "type", "dns")
+}
+
+// log returns the logger with the attributes identifying this tester.
+func (t *DNSBLTester) log() *slog.Logger {
+	return logger.With("server", t.ip, "type", "dnsbl")
+}
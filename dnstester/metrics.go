@@ -0,0 +1,96 @@
+package dnstester
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	recordPresent = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "dns_record_present",
+			Help:      "Whether the mail-related DNS record exists (1) or not (0)",
+			Namespace: "mailmetrix",
+		},
+		[]string{"domain", "record", "name"},
+	)
+	recordValid = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "dns_record_valid",
+			Help:      "Whether the mail-related DNS record is syntactically valid (1) or not (0)",
+			Namespace: "mailmetrix",
+		},
+		[]string{"domain", "record", "name"},
+	)
+	lookupTime = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "dns_lookup_seconds",
+			Help:      "Time to look up the mail-related DNS record",
+			Namespace: "mailmetrix",
+		},
+		[]string{"domain", "record", "name"},
+	)
+	mxExpectedMatch = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "dns_mx_expected_match",
+			Help:      "Whether the MX hosts match the configured expected hosts (1) or not (0)",
+			Namespace: "mailmetrix",
+		},
+		[]string{"domain"},
+	)
+	dnsblListed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "dnsbl_listed",
+			Help:      "Whether the IP is listed on the DNSBL zone (1) or not (0), by decoded return code",
+			Namespace: "mailmetrix",
+		},
+		[]string{"ip", "zone", "code"},
+	)
+	dnsblLookupTime = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "dnsbl_lookup_seconds",
+			Help:      "Time to query the DNSBL zone for the IP",
+			Namespace: "mailmetrix",
+		},
+		[]string{"ip", "zone"},
+	)
+	dnsblFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "dnsbl_failures_total",
+			Help:      "Total number of DNSBL query failures",
+			Namespace: "mailmetrix",
+		},
+		[]string{"ip", "zone"},
+	)
+	dnsFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "dns_failures_total",
+			Help:      "Total number of mail-related DNS lookup failures",
+			Namespace: "mailmetrix",
+		},
+		[]string{"domain", "record", "name"},
+	)
+)
+
+func init() {
+	metrics := []prometheus.Collector{
+		recordPresent,
+		recordValid,
+		lookupTime,
+		mxExpectedMatch,
+		dnsFailures,
+		dnsblListed,
+		dnsblLookupTime,
+		dnsblFailures,
+	}
+
+	for _, metric := range metrics {
+		if err := prometheus.Register(metric); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				prometheus.Unregister(are.ExistingCollector)
+				prometheus.MustRegister(metric)
+			} else {
+				logger.Error("Error registering metric", "error", err)
+			}
+		}
+	}
+}
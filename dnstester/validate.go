@@ -0,0 +1,298 @@
+package dnstester
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tag struct {
+	key   string
+	value string
+}
+
+// parseTags splits a tag=value; list as used by DMARC, DKIM, MTA-STS and TLSRPT records.
+func parseTags(record string) ([]tag, error) {
+	var tags []tag
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(record, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed tag %q", part)
+		}
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("empty tag name in %q", part)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate tag %q", key)
+		}
+		seen[key] = true
+		tags = append(tags, tag{key: key, value: strings.TrimSpace(value)})
+	}
+	return tags, nil
+}
+
+func tagValue(tags []tag, key string) (string, bool) {
+	for _, t := range tags {
+		if t.key == key {
+			return t.value, true
+		}
+	}
+	return "", false
+}
+
+// hasTagPrefix reports whether the first term of the record, up to a space or semicolon,
+// equals the version prefix. An empty prefix matches everything.
+func hasTagPrefix(record, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	fields := strings.FieldsFunc(record, func(r rune) bool { return r == ';' || unicode.IsSpace(r) })
+	return len(fields) > 0 && strings.EqualFold(fields[0], prefix)
+}
+
+// requireVersion checks that the record is a valid tag list whose first tag is v=version.
+func requireVersion(record, version string) ([]tag, error) {
+	tags, err := parseTags(record)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 || tags[0].key != "v" || tags[0].value != version {
+		return nil, fmt.Errorf("record must start with v=%s", version)
+	}
+	return tags, nil
+}
+
+var spfMechanism = regexp.MustCompile(`^[+\-~?]?(all|include|a|mx|ptr|ip4|ip6|exists)([:/].*)?$`)
+
+// spfLookupLimit is the RFC 7208 limit on DNS-querying terms in an SPF evaluation.
+const spfLookupLimit = 10
+
+func validateSPF(record string) error {
+	fields := strings.Fields(record)
+	lookups := 0
+	for _, term := range fields[1:] {
+		if name, value, ok := strings.Cut(term, "="); ok && !strings.ContainsAny(name, ":/") {
+			if name == "" || value == "" {
+				return fmt.Errorf("malformed modifier %q", term)
+			}
+			if strings.EqualFold(name, "redirect") {
+				lookups++
+			}
+			continue
+		}
+
+		m := spfMechanism.FindStringSubmatch(strings.ToLower(term))
+		if m == nil {
+			return fmt.Errorf("unknown mechanism %q", term)
+		}
+		arg := strings.TrimPrefix(m[2], ":")
+		switch m[1] {
+		case "include", "exists":
+			lookups++
+			if arg == "" || strings.HasPrefix(m[2], "/") {
+				return fmt.Errorf("%s requires a domain: %q", m[1], term)
+			}
+		case "a", "mx", "ptr":
+			lookups++
+		case "ip4", "ip6":
+			if !validIPArg(arg, m[1] == "ip6") {
+				return fmt.Errorf("invalid address in %q", term)
+			}
+		}
+	}
+	if lookups > spfLookupLimit {
+		return fmt.Errorf("%d DNS-querying terms exceed the limit of %d", lookups, spfLookupLimit)
+	}
+	return nil
+}
+
+func validIPArg(arg string, v6 bool) bool {
+	address, bits, hasBits := strings.Cut(arg, "/")
+	ip := net.ParseIP(address)
+	if ip == nil || (ip.To4() == nil) != v6 {
+		return false
+	}
+	if !hasBits {
+		return true
+	}
+	n, err := strconv.Atoi(bits)
+	limit := 32
+	if v6 {
+		limit = 128
+	}
+	return err == nil && n >= 0 && n <= limit
+}
+
+func validateDMARC(record string) error {
+	tags, err := requireVersion(record, "DMARC1")
+	if err != nil {
+		return err
+	}
+	policy, ok := tagValue(tags, "p")
+	if !ok {
+		return fmt.Errorf("missing p= tag")
+	}
+	if !validDMARCPolicy(policy) {
+		return fmt.Errorf("invalid policy %q", policy)
+	}
+	if sp, ok := tagValue(tags, "sp"); ok && !validDMARCPolicy(sp) {
+		return fmt.Errorf("invalid subdomain policy %q", sp)
+	}
+	if pct, ok := tagValue(tags, "pct"); ok {
+		if n, err := strconv.Atoi(pct); err != nil || n < 0 || n > 100 {
+			return fmt.Errorf("invalid pct %q", pct)
+		}
+	}
+	for _, key := range []string{"rua", "ruf"} {
+		if value, ok := tagValue(tags, key); ok {
+			if err := validateURIList(value, "mailto"); err != nil {
+				return fmt.Errorf("invalid %s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validDMARCPolicy(policy string) bool {
+	return policy == "none" || policy == "quarantine" || policy == "reject"
+}
+
+func validateDKIM(record string) error {
+	tags, err := parseTags(record)
+	if err != nil {
+		return err
+	}
+	if v, ok := tagValue(tags, "v"); ok && (tags[0].key != "v" || v != "DKIM1") {
+		return fmt.Errorf("v= tag must be first and equal DKIM1")
+	}
+	if k, ok := tagValue(tags, "k"); ok && k != "rsa" && k != "ed25519" {
+		return fmt.Errorf("unsupported key type %q", k)
+	}
+	key, ok := tagValue(tags, "p")
+	if !ok {
+		return fmt.Errorf("missing p= tag")
+	}
+	key = strings.Join(strings.Fields(key), "")
+	if key == "" {
+		return fmt.Errorf("key has been revoked")
+	}
+	if _, err := base64.StdEncoding.DecodeString(key); err != nil {
+		return fmt.Errorf("public key is not valid base64: %w", err)
+	}
+	return nil
+}
+
+var stsID = regexp.MustCompile(`^[A-Za-z0-9]{1,32}$`)
+
+func validateSTSRecord(record string) error {
+	tags, err := requireVersion(record, "STSv1")
+	if err != nil {
+		return err
+	}
+	id, ok := tagValue(tags, "id")
+	if !ok || !stsID.MatchString(id) {
+		return fmt.Errorf("id must be 1 to 32 alphanumeric characters")
+	}
+	return nil
+}
+
+func validateTLSRPT(record string) error {
+	tags, err := requireVersion(record, "TLSRPTv1")
+	if err != nil {
+		return err
+	}
+	rua, ok := tagValue(tags, "rua")
+	if !ok {
+		return fmt.Errorf("missing rua= tag")
+	}
+	return validateURIList(rua, "mailto", "https")
+}
+
+// validateURIList checks a comma-separated list of report URIs against the allowed schemes.
+func validateURIList(list string, schemes ...string) error {
+	for _, raw := range strings.Split(list, ",") {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil {
+			return err
+		}
+		valid := false
+		for _, scheme := range schemes {
+			if strings.EqualFold(u.Scheme, scheme) {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("unsupported URI %q", raw)
+		}
+	}
+	return nil
+}
+
+type stsPolicy struct {
+	mode string
+	mx   []string
+}
+
+// matches reports whether host is covered by one of the policy mx patterns.
+// A leading "*." matches exactly one label.
+func (p stsPolicy) matches(host string) bool {
+	for _, pattern := range p.mx {
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			label, rest, found := strings.Cut(host, ".")
+			if found && label != "" && rest == suffix {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSTSPolicy parses and validates an RFC 8461 policy file.
+func parseSTSPolicy(body string) (stsPolicy, error) {
+	var p stsPolicy
+	fields := make(map[string]string)
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return p, fmt.Errorf("malformed line %q", line)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "mx" {
+			p.mx = append(p.mx, normalizeHost(value))
+			continue
+		}
+		fields[key] = value
+	}
+
+	if fields["version"] != "STSv1" {
+		return p, fmt.Errorf("version must be STSv1")
+	}
+	p.mode = fields["mode"]
+	if p.mode != "enforce" && p.mode != "testing" && p.mode != "none" {
+		return p, fmt.Errorf("invalid mode %q", p.mode)
+	}
+	if n, err := strconv.Atoi(fields["max_age"]); err != nil || n < 0 || n > 31557600 {
+		return p, fmt.Errorf("invalid max_age %q", fields["max_age"])
+	}
+	if p.mode != "none" && len(p.mx) == 0 {
+		return p, fmt.Errorf("mode %s requires at least one mx", p.mode)
+	}
+	return p, nil
+}
@@ -0,0 +1,208 @@
+package dnstester
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSPF(t *testing.T) {
+	includes := func(n int) string {
+		return strings.Repeat(" include:_spf.example.com", n)
+	}
+	tests := []struct {
+		name    string
+		record  string
+		wantErr bool
+	}{
+		{"minimal", "v=spf1 -all", false},
+		{"mechanisms", "v=spf1 a mx ip4:192.0.2.1 ip6:2001:db8::1 include:_spf.example.com ~all", false},
+		{"qualifiers", "v=spf1 +a -mx ?ptr ~exists:%{i}.example.com -all", false},
+		{"modifiers", "v=spf1 mx redirect=_spf.example.com exp=explain.example.com", false},
+		{"ten lookups", "v=spf1" + includes(10) + " -all", false},
+		{"eleven lookups", "v=spf1" + includes(11) + " -all", true},
+		{"redirect counts as a lookup", "v=spf1" + includes(10) + " redirect=_spf.example.com", true},
+		{"ip terms are not lookups", "v=spf1" + includes(10) + " ip4:192.0.2.1 ip6:2001:db8::1 -all", false},
+		{"ip4 cidr", "v=spf1 ip4:192.0.2.0/24 -all", false},
+		{"ip4 cidr upper bound", "v=spf1 ip4:192.0.2.1/32 -all", false},
+		{"ip4 cidr too long", "v=spf1 ip4:192.0.2.0/33 -all", true},
+		{"ip4 cidr negative", "v=spf1 ip4:192.0.2.0/-1 -all", true},
+		{"ip4 with ipv6 address", "v=spf1 ip4:2001:db8::1 -all", true},
+		{"ip6 cidr upper bound", "v=spf1 ip6:2001:db8::/128 -all", false},
+		{"ip6 cidr too long", "v=spf1 ip6:2001:db8::/129 -all", true},
+		{"ip6 with ipv4 address", "v=spf1 ip6:192.0.2.1 -all", true},
+		{"ip4 without address", "v=spf1 ip4 -all", true},
+		{"include without domain", "v=spf1 include -all", true},
+		{"unknown mechanism", "v=spf1 foo -all", true},
+		{"empty modifier", "v=spf1 redirect= -all", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateSPF(tt.record); (err != nil) != tt.wantErr {
+				t.Errorf("validateSPF(%q) = %v, want error %v", tt.record, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateDMARC(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  string
+		wantErr bool
+	}{
+		{"minimal", "v=DMARC1; p=none", false},
+		{"full", "v=DMARC1; p=reject; sp=quarantine; pct=50; rua=mailto:a@example.com,mailto:b@example.com; ruf=mailto:f@example.com", false},
+		{"version not first", "p=none; v=DMARC1", true},
+		{"wrong version", "v=DMARC2; p=none", true},
+		{"missing policy", "v=DMARC1; rua=mailto:a@example.com", true},
+		{"invalid policy", "v=DMARC1; p=block", true},
+		{"invalid subdomain policy", "v=DMARC1; p=none; sp=block", true},
+		{"pct too high", "v=DMARC1; p=none; pct=101", true},
+		{"pct not a number", "v=DMARC1; p=none; pct=all", true},
+		{"https report uri", "v=DMARC1; p=none; rua=https://example.com/report", true},
+		{"duplicate tag", "v=DMARC1; p=none; p=reject", true},
+		{"malformed tag", "v=DMARC1; p=none; rua", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateDMARC(tt.record); (err != nil) != tt.wantErr {
+				t.Errorf("validateDMARC(%q) = %v, want error %v", tt.record, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateDKIM(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  string
+		wantErr bool
+	}{
+		{"key only", "p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQCw", false},
+		{"full", "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQCw", false},
+		{"ed25519", "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=", false},
+		{"key split by whitespace", "v=DKIM1; p=MIGfMA0GCSqG SIb3DQEBAQUA A4GNADCBiQKBgQCw", false},
+		{"version not first", "k=rsa; v=DKIM1; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQCw", true},
+		{"wrong version", "v=DKIM2; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQCw", true},
+		{"unsupported key type", "v=DKIM1; k=dsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQCw", true},
+		{"missing key", "v=DKIM1; k=rsa", true},
+		{"revoked key", "v=DKIM1; p=", true},
+		{"key not base64", "v=DKIM1; p=not*base64", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateDKIM(tt.record); (err != nil) != tt.wantErr {
+				t.Errorf("validateDKIM(%q) = %v, want error %v", tt.record, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSTSRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  string
+		wantErr bool
+	}{
+		{"valid", "v=STSv1; id=20240101T000000", false},
+		{"longest id", "v=STSv1; id=" + strings.Repeat("a", 32), false},
+		{"id too long", "v=STSv1; id=" + strings.Repeat("a", 33), true},
+		{"id not alphanumeric", "v=STSv1; id=2024-01-01", true},
+		{"missing id", "v=STSv1", true},
+		{"wrong version", "v=STSv2; id=1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateSTSRecord(tt.record); (err != nil) != tt.wantErr {
+				t.Errorf("validateSTSRecord(%q) = %v, want error %v", tt.record, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTLSRPT(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  string
+		wantErr bool
+	}{
+		{"mailto", "v=TLSRPTv1; rua=mailto:tlsrpt@example.com", false},
+		{"https and mailto", "v=TLSRPTv1; rua=https://example.com/tlsrpt,mailto:tlsrpt@example.com", false},
+		{"missing rua", "v=TLSRPTv1", true},
+		{"unsupported scheme", "v=TLSRPTv1; rua=ftp://example.com/tlsrpt", true},
+		{"wrong version", "v=TLSRPTv2; rua=mailto:tlsrpt@example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateTLSRPT(tt.record); (err != nil) != tt.wantErr {
+				t.Errorf("validateTLSRPT(%q) = %v, want error %v", tt.record, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSTSPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantMode string
+		wantMX   []string
+		wantErr  bool
+	}{
+		{
+			name:     "enforce",
+			body:     "version: STSv1\r\nmode: enforce\r\nmx: mx1.example.com\r\nmx: *.example.net\r\nmax_age: 86400\r\n",
+			wantMode: "enforce",
+			wantMX:   []string{"mx1.example.com", "*.example.net"},
+		},
+		{
+			name:     "none without mx",
+			body:     "version: STSv1\nmode: none\nmax_age: 86400\n",
+			wantMode: "none",
+		},
+		{name: "enforce without mx", body: "version: STSv1\nmode: enforce\nmax_age: 86400\n", wantErr: true},
+		{name: "wrong version", body: "version: STSv2\nmode: none\nmax_age: 86400\n", wantErr: true},
+		{name: "invalid mode", body: "version: STSv1\nmode: strict\nmx: mx.example.com\nmax_age: 86400\n", wantErr: true},
+		{name: "missing max_age", body: "version: STSv1\nmode: testing\nmx: mx.example.com\n", wantErr: true},
+		{name: "max_age too high", body: "version: STSv1\nmode: testing\nmx: mx.example.com\nmax_age: 31557601\n", wantErr: true},
+		{name: "malformed line", body: "version: STSv1\nmode testing\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseSTSPolicy(tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSTSPolicy() = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if p.mode != tt.wantMode {
+				t.Errorf("mode = %q, want %q", p.mode, tt.wantMode)
+			}
+			if strings.Join(p.mx, ",") != strings.Join(tt.wantMX, ",") {
+				t.Errorf("mx = %v, want %v", p.mx, tt.wantMX)
+			}
+		})
+	}
+}
+
+func TestSTSPolicyMatches(t *testing.T) {
+	p := stsPolicy{mode: "enforce", mx: []string{"mx1.example.com", "*.example.net"}}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"mx1.example.com", true},
+		{"mx2.example.com", false},
+		{"mx.example.net", true},
+		{"a.mx.example.net", false},
+		{"example.net", false},
+		{".example.net", false},
+		{"mx.example.net.evil.com", false},
+	}
+	for _, tt := range tests {
+		if got := p.matches(tt.host); got != tt.want {
+			t.Errorf("matches(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Package errclass sorts probe failures into a small set of reasons that are shared by the
+// testers and exported as the reason label of their failure counters.
+package errclass
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+)
+
+// Failure reasons. The IMAP tester falls back to plaintext when the TLS handshake fails,
+// so its failures never carry TLS.
+const (
+	DNS               = "dns"
+	Connect           = "connect"
+	TLS               = "tls"
+	Auth              = "auth"
+	Protocol          = "protocol"
+	Timeout           = "timeout"
+	HTTPStatus        = "http_status"
+	UnexpectedContent = "unexpected_content"
+)
+
+// Error carries an explicit reason for failures that cannot be told apart by their type,
+// such as a response that parsed but lacked the expected data.
+type Error struct {
+	Reason string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New wraps err with the given reason.
+func New(reason string, err error) error {
+	return &Error{Reason: reason, Err: err}
+}
+
+// Errorf formats an error with the given reason.
+func Errorf(reason, format string, args ...interface{}) error {
+	return &Error{Reason: reason, Err: fmt.Errorf(format, args...)}
+}
+
+// HTTPStatusError is returned when a server answers with an unexpected HTTP status.
+type HTTPStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("status code: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// Classify returns the reason for err. Errors without a recognizable cause are reported
+// as protocol errors.
+func Classify(err error) string {
+	var explicit *Error
+	if errors.As(err, &explicit) {
+		return explicit.Reason
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusProxyAuthRequired:
+			return Auth
+		}
+		return HTTPStatus
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return DNS
+	}
+
+	if isTLS(err) {
+		return TLS
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return Timeout
+	}
+
+	var opErr *net.OpError
+	if (errors.As(err, &opErr) && opErr.Op == "dial") ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) {
+		return Connect
+	}
+
+	return Protocol
+}
+
+func isTLS(err error) bool {
+	var (
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	return errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
@@ -0,0 +1,53 @@
+package errclass
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"explicit", Errorf(UnexpectedContent, "no inbox"), UnexpectedContent},
+		{"explicit wrapping status", New(UnexpectedContent, &HTTPStatusError{StatusCode: 401}), UnexpectedContent},
+		{"wrapped explicit", fmt.Errorf("login failed: %w", Errorf(Auth, "bad credentials")), Auth},
+		{"status 401", fmt.Errorf("login failed: %w", &HTTPStatusError{StatusCode: 401}), Auth},
+		{"status 403", fmt.Errorf("login failed: %w", &HTTPStatusError{StatusCode: 403}), Auth},
+		{"status 407", fmt.Errorf("login failed: %w", &HTTPStatusError{StatusCode: 407}), Auth},
+		{"status 404", fmt.Errorf("listing failed: %w", &HTTPStatusError{StatusCode: 404}), HTTPStatus},
+		{"status 500", fmt.Errorf("listing failed: %w", &HTTPStatusError{StatusCode: 500, Body: "oops"}), HTTPStatus},
+		{"dns not found", fmt.Errorf("lookup: %w", &net.DNSError{Err: "no such host", Name: "mail.example.org", IsNotFound: true}), DNS},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", Name: "mail.example.org", IsTimeout: true}, DNS},
+		{"dial dns", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "mail.example.org"}}, DNS},
+		{"tls record", fmt.Errorf("handshake: %w", tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), TLS},
+		{"tls alert", &net.OpError{Op: "remote error", Err: tls.AlertError(40)}, TLS},
+		{"tls verify", fmt.Errorf("handshake: %w", &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}), TLS},
+		{"x509 hostname", x509.HostnameError{Certificate: &x509.Certificate{}, Host: "mail.example.org"}, TLS},
+		{"x509 expired", x509.CertificateInvalidError{Reason: x509.Expired}, TLS},
+		{"deadline exceeded", fmt.Errorf("session timed out: %w", context.DeadlineExceeded), Timeout},
+		{"os deadline", &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, Timeout},
+		{"dial timeout", &net.OpError{Op: "dial", Net: "tcp", Err: context.DeadlineExceeded}, Timeout},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, Connect},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, Connect},
+		{"host unreachable", fmt.Errorf("connect: %w", syscall.EHOSTUNREACH), Connect},
+		{"protocol", errors.New("NO [SERVERBUG] internal error"), Protocol},
+		{"canceled", context.Canceled, Protocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
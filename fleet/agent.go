@@ -0,0 +1,218 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/results"
+)
+
+const (
+	// reportInterval is how often the queued results are sent to the controller.
+	reportInterval = 10 * time.Second
+	// retryInterval is how soon the first assignment is requested again after a failure.
+	retryInterval = 10 * time.Second
+	// maxPendingResults bounds the results kept while the controller is unreachable;
+	// the oldest are dropped first.
+	maxPendingResults = 10000
+	// maxReportBatch is the number of results sent in one request.
+	maxReportBatch = 1000
+	requestTimeout = 30 * time.Second
+)
+
+// Agent is a results.Observer that reports every result to the controller, and keeps
+// the targets of this instance in line with the assignment of the controller.
+type Agent struct {
+	cfg    config.AgentConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	pending []results.Entry
+}
+
+func NewAgent(cfg config.AgentConfig) (*Agent, error) {
+	tlsConfig := &tls.Config{}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+	}
+	if cfg.CertFile != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile); err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		// Loading the certificate for every connection picks up renewed certificates.
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+			return &cert, err
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Agent{cfg: cfg, client: &http.Client{Transport: transport, Timeout: requestTimeout}}, nil
+}
+
+// Observe queues the result for the next report to the controller.
+func (a *Agent) Observe(r results.Result) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pending = append(a.pending, r.Entry())
+	a.trim()
+}
+
+// trim drops the oldest results beyond maxPendingResults. The caller holds a.mu.
+func (a *Agent) trim() {
+	if dropped := len(a.pending) - maxPendingResults; dropped > 0 {
+		logger.Warn("Dropping results the controller has not received", "results", dropped)
+		a.pending = append([]results.Entry(nil), a.pending[dropped:]...)
+	}
+	agentPendingResults.Set(float64(len(a.pending)))
+}
+
+// Start polls the controller for the assignment, calling apply with the first one and
+// with every change, and reports the queued results until ctx is done.
+func (a *Agent) Start(ctx context.Context, apply func(*Assignment)) {
+	go a.pollLoop(ctx, apply)
+	go a.reportLoop(ctx)
+}
+
+func (a *Agent) pollLoop(ctx context.Context, apply func(*Assignment)) {
+	pollInterval := time.Duration(a.cfg.PollIntervalSeconds) * time.Second
+	var current []byte
+	for {
+		body, err := a.fetch(ctx)
+		if err != nil {
+			logger.Error("Fetching the assignment failed", "controller", a.cfg.ControllerURL, "error", err)
+		} else if !bytes.Equal(body, current) {
+			var assignment Assignment
+			if err := json.Unmarshal(body, &assignment); err != nil {
+				logger.Error("Invalid assignment", "controller", a.cfg.ControllerURL, "error", err)
+			} else {
+				current = body
+				logger.Info("Probing assigned targets", "targets", len(assignment.targets()), "location", assignment.Location)
+				apply(&assignment)
+			}
+		}
+
+		wait := pollInterval
+		if current == nil {
+			wait = min(retryInterval, pollInterval)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *Agent) fetch(ctx context.Context) ([]byte, error) {
+	req, err := a.newRequest(ctx, http.MethodGet, "/api/agent/config", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxReportSize))
+}
+
+func (a *Agent) reportLoop(ctx context.Context) {
+	ticker := time.NewTicker(reportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for a.reportBatch(ctx) {
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reportBatch sends up to maxReportBatch of the queued results, putting them back at the
+// front of the queue if the controller does not accept them. It reports whether more
+// results are waiting to be sent.
+func (a *Agent) reportBatch(ctx context.Context) bool {
+	a.mu.Lock()
+	n := min(len(a.pending), maxReportBatch)
+	batch := a.pending[:n:n]
+	a.pending = a.pending[n:]
+	a.mu.Unlock()
+	if len(batch) == 0 {
+		return false
+	}
+
+	if err := a.report(ctx, batch); err != nil {
+		logger.Error("Reporting results failed", "controller", a.cfg.ControllerURL, "results", len(batch), "error", err)
+		a.mu.Lock()
+		a.pending = append(batch, a.pending...)
+		a.trim()
+		a.mu.Unlock()
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	agentPendingResults.Set(float64(len(a.pending)))
+	return len(a.pending) > 0
+}
+
+func (a *Agent) report(ctx context.Context, batch []results.Entry) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	req, err := a.newRequest(ctx, http.MethodPost, "/api/agent/results", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (a *Agent) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	url := strings.TrimSuffix(a.cfg.ControllerURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(tokenHeader, a.cfg.Token)
+	if a.cfg.Username != "" {
+		req.SetBasicAuth(a.cfg.Username, a.cfg.Password)
+	}
+	return req, nil
+}
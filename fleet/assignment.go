@@ -0,0 +1,135 @@
+// Package fleet runs mailmetrix at several locations: probe agents fetch the targets
+// assigned to them from a controller and report their results back, and the controller
+// exposes every result with the location it was measured from.
+package fleet
+
+import (
+	"github.com/dniminenn/mailmetrix/config"
+)
+
+// Assignment is what the controller sends an agent: the location it reports as and the
+// configuration of the targets it probes.
+type Assignment struct {
+	Location string `json:"location"`
+	// IMAPHosts are the hosts of every IMAP server of the controller, which the autoconfig
+	// tester compares the advertised settings with.
+	IMAPHosts  []string                `json:"imap_hosts"`
+	IMAP       config.IMAPConfig       `json:"imap"`
+	Webmail    config.WebmailConfig    `json:"webmail"`
+	DNS        config.DNSConfig        `json:"dns"`
+	SMTP       config.SMTPConfig       `json:"smtp"`
+	Sieve      config.SieveConfig      `json:"sieve"`
+	DAV        config.DAVConfig        `json:"dav"`
+	Autoconfig config.AutoconfigConfig `json:"autoconfig"`
+}
+
+// Apply replaces the targets of cfg with the assigned ones.
+func (a *Assignment) Apply(cfg *config.Config) {
+	cfg.IMAP = a.IMAP
+	cfg.Webmail = a.Webmail
+	cfg.DNS = a.DNS
+	cfg.SMTP = a.SMTP
+	cfg.Sieve = a.Sieve
+	cfg.DAV = a.DAV
+	cfg.Autoconfig = a.Autoconfig
+}
+
+// target identifies a probe target the way results do.
+type target struct {
+	kind, server string
+}
+
+// targets returns the set of assigned targets.
+func (a *Assignment) targets() map[target]bool {
+	set := make(map[target]bool)
+	for _, s := range a.IMAP.Servers {
+		set[target{"imap", s.Name}] = true
+	}
+	for _, s := range a.Webmail.Servers {
+		set[target{"webmail", s.Name}] = true
+	}
+	for _, d := range a.DNS.Domains {
+		set[target{"dns", d.Domain}] = true
+	}
+	for _, ip := range a.DNS.DNSBL.IPs {
+		set[target{"dnsbl", ip}] = true
+	}
+	for _, s := range a.SMTP.Servers {
+		set[target{"smtp", s.Name}] = true
+	}
+	for _, s := range a.Sieve.Servers {
+		set[target{"sieve", s.Name}] = true
+	}
+	for _, s := range a.DAV.Servers {
+		set[target{"dav", s.Name}] = true
+	}
+	for _, d := range a.Autoconfig.Domains {
+		set[target{"autoconfig", d.Domain}] = true
+	}
+	return set
+}
+
+// assign selects the targets of cfg configured for the agent.
+func assign(cfg *config.Config, agent config.AgentLocationConfig) *Assignment {
+	selected := func(kind, name string) bool {
+		if len(agent.Targets) == 0 {
+			return true
+		}
+		for _, t := range agent.Targets {
+			if t.Kind == kind && (t.Server == "" || t.Server == name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	a := &Assignment{
+		Location: agent.Location,
+		DNS: config.DNSConfig{
+			Resolver: cfg.DNS.Resolver,
+			DNSBL:    config.DNSBLConfig{Resolver: cfg.DNS.DNSBL.Resolver, Zones: cfg.DNS.DNSBL.Zones},
+		},
+	}
+	for _, s := range cfg.IMAP.Servers {
+		a.IMAPHosts = append(a.IMAPHosts, s.Host)
+		if selected("imap", s.Name) {
+			a.IMAP.Servers = append(a.IMAP.Servers, s)
+		}
+	}
+	for _, s := range cfg.Webmail.Servers {
+		if selected("webmail", s.Name) {
+			a.Webmail.Servers = append(a.Webmail.Servers, s)
+		}
+	}
+	for _, d := range cfg.DNS.Domains {
+		if selected("dns", d.Domain) {
+			a.DNS.Domains = append(a.DNS.Domains, d)
+		}
+	}
+	for _, ip := range cfg.DNS.DNSBL.IPs {
+		if selected("dnsbl", ip) {
+			a.DNS.DNSBL.IPs = append(a.DNS.DNSBL.IPs, ip)
+		}
+	}
+	for _, s := range cfg.SMTP.Servers {
+		if selected("smtp", s.Name) {
+			a.SMTP.Servers = append(a.SMTP.Servers, s)
+		}
+	}
+	for _, s := range cfg.Sieve.Servers {
+		if selected("sieve", s.Name) {
+			a.Sieve.Servers = append(a.Sieve.Servers, s)
+		}
+	}
+	for _, s := range cfg.DAV.Servers {
+		if selected("dav", s.Name) {
+			a.DAV.Servers = append(a.DAV.Servers, s)
+		}
+	}
+	for _, d := range cfg.Autoconfig.Domains {
+		if selected("autoconfig", d.Domain) {
+			a.Autoconfig.Domains = append(a.Autoconfig.Domains, d)
+		}
+	}
+	return a
+}
@@ -0,0 +1,283 @@
+package fleet
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/logging"
+	"github.com/dniminenn/mailmetrix/results"
+)
+
+var logger = logging.New("fleet")
+
+const (
+	// maxReportSize bounds the body of a results report.
+	maxReportSize = 10 << 20
+	tokenHeader   = "X-Mailmetrix-Agent-Token"
+)
+
+// Target statuses, comparing the recent results of every location.
+const (
+	StatusUp = "up"
+	// StatusRegional means some locations fail while others succeed, which points at the
+	// network of those locations rather than at the server.
+	StatusRegional = "regional"
+	StatusDown     = "down"
+	StatusUnknown  = "unknown"
+)
+
+type agent struct {
+	location   string
+	token      []byte
+	assignment []byte
+	targets    map[target]bool
+}
+
+// Controller is a results.Observer for the probes of this instance that also serves the
+// agents, keeping the latest result of every target per location.
+type Controller struct {
+	location string
+	// staleAfter is how long after its probe ran a result counts in the status of its target.
+	staleAfter time.Duration
+	agents     []*agent
+
+	mu     sync.Mutex
+	latest map[target]map[string]results.Entry
+}
+
+// NewController creates a controller for the agents of cfg. Results older than staleAfter
+// no longer count in the status of their target.
+func NewController(cfg *config.Config, staleAfter time.Duration) (*Controller, error) {
+	c := &Controller{
+		location:   cfg.Controller.Location,
+		staleAfter: staleAfter,
+		latest:     make(map[target]map[string]results.Entry),
+	}
+	for _, a := range cfg.Controller.Agents {
+		assignment := assign(cfg, a)
+		body, err := json.Marshal(assignment)
+		if err != nil {
+			return nil, err
+		}
+		c.agents = append(c.agents, &agent{
+			location:   a.Location,
+			token:      []byte(a.Token),
+			assignment: body,
+			targets:    assignment.targets(),
+		})
+	}
+	return c, nil
+}
+
+// Observe records the result of a probe run by this instance.
+func (c *Controller) Observe(r results.Result) {
+	c.record(c.location, r.Entry(), time.Now())
+}
+
+// record counts e and keeps it as the latest result of its target at location, unless a
+// newer one is already known.
+func (c *Controller) record(location string, e results.Entry, now time.Time) {
+	locationProbeAttempts.WithLabelValues(location, e.Kind, e.Server).Inc()
+	if e.Success {
+		locationProbeSuccesses.WithLabelValues(location, e.Kind, e.Server).Inc()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := target{e.Kind, e.Server}
+	if c.latest[t] == nil {
+		c.latest[t] = make(map[string]results.Entry)
+	}
+	if latest, ok := c.latest[t][location]; ok && e.Time.Before(latest.Time) {
+		return
+	}
+	c.latest[t][location] = e
+	locationProbeSuccess.WithLabelValues(location, e.Kind, e.Server).Set(boolToFloat(e.Success))
+	locationProbeDuration.WithLabelValues(location, e.Kind, e.Server).Set(e.Duration)
+
+	reporting, failing := c.count(t, now)
+	targetLocations.WithLabelValues(t.kind, t.server).Set(float64(reporting))
+	targetFailingLocations.WithLabelValues(t.kind, t.server).Set(float64(failing))
+}
+
+// count returns the number of locations with a recent result for the target, and how
+// many of those failed.
+func (c *Controller) count(t target, now time.Time) (reporting, failing int) {
+	for _, e := range c.latest[t] {
+		if c.stale(e, now) {
+			continue
+		}
+		reporting++
+		if !e.Success {
+			failing++
+		}
+	}
+	return reporting, failing
+}
+
+// stale reports whether the probe of e ran too long ago to count in the status of its target.
+func (c *Controller) stale(e results.Entry, now time.Time) bool {
+	return now.Sub(e.Time) > c.staleAfter
+}
+
+func classify(reporting, failing int) string {
+	switch {
+	case reporting == 0:
+		return StatusUnknown
+	case failing == 0:
+		return StatusUp
+	case failing == reporting:
+		return StatusDown
+	default:
+		return StatusRegional
+	}
+}
+
+// authenticate returns the agent of the token of the request. The token has its own
+// header, since the Authorization header carries the basic-auth credentials of the web
+// config.
+func (c *Controller) authenticate(r *http.Request) *agent {
+	token := r.Header.Get(tokenHeader)
+	if token == "" {
+		return nil
+	}
+	for _, a := range c.agents {
+		if subtle.ConstantTimeCompare([]byte(token), a.token) == 1 {
+			return a
+		}
+	}
+	return nil
+}
+
+// AgentHandler serves the agents, which identify themselves with their token in the
+// X-Mailmetrix-Agent-Token header: GET /api/agent/config returns the assignment of the
+// agent and POST /api/agent/results takes a JSON list of its results.
+func (c *Controller) AgentHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/agent/config", c.serveConfig)
+	mux.HandleFunc("/api/agent/results", c.serveResults)
+	return mux
+}
+
+func (c *Controller) serveConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a := c.authenticate(r)
+	if a == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(a.assignment)
+}
+
+func (c *Controller) serveResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a := c.authenticate(r)
+	if a == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var entries []results.Entry
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReportSize)).Decode(&entries); err != nil {
+		http.Error(w, "invalid results: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	unassigned, stale := 0, 0
+	for _, e := range entries {
+		// Only assigned targets are accepted, so an agent cannot add arbitrary series.
+		if !a.targets[target{e.Kind, e.Server}] {
+			unassigned++
+			continue
+		}
+		// Results an agent buffered while the controller was unreachable would otherwise
+		// count as current.
+		if c.stale(e, now) {
+			stale++
+			continue
+		}
+		c.record(a.location, e, now)
+	}
+	if unassigned > 0 {
+		logger.Warn("Ignored results for unassigned targets", "location", a.location, "results", unassigned)
+	}
+	if stale > 0 {
+		logger.Warn("Ignored stale results", "location", a.location, "results", stale)
+	}
+	agentLastReport.WithLabelValues(a.location).Set(float64(now.Unix()))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type locationStatus struct {
+	Location string `json:"location"`
+	// Stale is set when the location has not reported the target recently.
+	Stale bool `json:"stale"`
+	results.Entry
+}
+
+type targetStatus struct {
+	Kind      string           `json:"kind"`
+	Server    string           `json:"server"`
+	Status    string           `json:"status"`
+	Locations []locationStatus `json:"locations"`
+}
+
+// Handler serves GET /api/locations: the latest result of every target per location,
+// with the status of the target across the locations.
+func (c *Controller) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.statuses(time.Now()))
+	})
+}
+
+func (c *Controller) statuses(now time.Time) []targetStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	list := []targetStatus{}
+	for t, byLocation := range c.latest {
+		status := targetStatus{Kind: t.kind, Server: t.server, Status: classify(c.count(t, now))}
+		for location, e := range byLocation {
+			status.Locations = append(status.Locations, locationStatus{
+				Location: location,
+				Stale:    c.stale(e, now),
+				Entry:    e,
+			})
+		}
+		sort.Slice(status.Locations, func(i, j int) bool {
+			return status.Locations[i].Location < status.Locations[j].Location
+		})
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Kind != list[j].Kind {
+			return list[i].Kind < list[j].Kind
+		}
+		return list[i].Server < list[j].Server
+	})
+	return list
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+package fleet
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	locationProbeSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "location_probe_success",
+			Help:      "Whether the last probe session from the location succeeded (1) or failed (0)",
+			Namespace: "mailmetrix",
+		},
+		[]string{"location", "kind", "server"},
+	)
+	locationProbeDuration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "location_probe_duration_seconds",
+			Help:      "Duration of the last probe session from the location",
+			Namespace: "mailmetrix",
+		},
+		[]string{"location", "kind", "server"},
+	)
+	locationProbeAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "location_probe_attempts_total",
+			Help:      "Total number of probe sessions run from the location",
+			Namespace: "mailmetrix",
+		},
+		[]string{"location", "kind", "server"},
+	)
+	locationProbeSuccesses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "location_probe_successes_total",
+			Help:      "Total number of probe sessions from the location that succeeded",
+			Namespace: "mailmetrix",
+		},
+		[]string{"location", "kind", "server"},
+	)
+	targetLocations = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "target_locations",
+			Help:      "Number of locations with a recent result for the target",
+			Namespace: "mailmetrix",
+		},
+		[]string{"kind", "server"},
+	)
+	targetFailingLocations = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "target_failing_locations",
+			Help:      "Number of locations whose recent result for the target failed",
+			Namespace: "mailmetrix",
+		},
+		[]string{"kind", "server"},
+	)
+	agentLastReport = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "agent_last_report_timestamp_seconds",
+			Help:      "Unix time of the last results reported by the agent of the location",
+			Namespace: "mailmetrix",
+		},
+		[]string{"location"},
+	)
+	agentPendingResults = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:      "agent_pending_results",
+			Help:      "Number of results waiting to be reported to the controller",
+			Namespace: "mailmetrix",
+		},
+	)
+)
+
+func init() {
+	metrics := []prometheus.Collector{
+		locationProbeSuccess,
+		locationProbeDuration,
+		locationProbeAttempts,
+		locationProbeSuccesses,
+		targetLocations,
+		targetFailingLocations,
+		agentLastReport,
+		agentPendingResults,
+	}
+
+	for _, metric := range metrics {
+		if err := prometheus.Register(metric); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				prometheus.Unregister(are.ExistingCollector)
+				prometheus.MustRegister(metric)
+			} else {
+				logger.Error("Error registering metric", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package history
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultQueryWindow = 24 * time.Hour
+	defaultQueryLimit  = 1000
+	maxQueryLimit      = 10000
+)
+
+// Handler serves GET /api/results?server=&since=&limit= as JSON. since is an RFC 3339 time
+// or a duration before now such as "2h"; it defaults to the last 24 hours.
+func (s *Store) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		since := time.Now().Add(-defaultQueryWindow)
+		if v := query.Get("since"); v != "" {
+			var err error
+			if since, err = parseSince(v); err != nil {
+				http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		limit := defaultQueryLimit
+		if v := query.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > maxQueryLimit {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		entries, err := s.Query(query.Get("server"), since, limit)
+		if err != nil {
+			logger.Error("Query failed", "error", err)
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	})
+}
+
+func parseSince(v string) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
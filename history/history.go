@@ -0,0 +1,138 @@
+// Package history keeps every probe result, with its step details, in a BoltDB file so
+// individual sessions can be looked up after the fact.
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/logging"
+	"github.com/dniminenn/mailmetrix/results"
+	bolt "go.etcd.io/bbolt"
+)
+
+var logger = logging.New("history")
+
+var resultsBucket = []byte("results")
+
+// pruneInterval is how often results older than the retention are deleted.
+const pruneInterval = time.Hour
+
+// Store is a results.Observer that writes each result to the database.
+type Store struct {
+	db        *bolt.DB
+	retention time.Duration
+	done      chan struct{}
+}
+
+// Open opens or creates the database at path and starts pruning results older than retention.
+func Open(path string, retention time.Duration) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(resultsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize history database: %w", err)
+	}
+
+	s := &Store{db: db, retention: retention, done: make(chan struct{})}
+	go s.pruneLoop()
+	return s, nil
+}
+
+// Close stops pruning and closes the database.
+func (s *Store) Close() error {
+	close(s.done)
+	return s.db.Close()
+}
+
+// key orders results by time; the kind and server keep keys of concurrent results unique.
+func key(e results.Entry) []byte {
+	k := make([]byte, 8, 8+len(e.Kind)+len(e.Server)+2)
+	binary.BigEndian.PutUint64(k, uint64(e.Time.UnixNano()))
+	k = append(k, 0)
+	k = append(k, e.Kind...)
+	k = append(k, 0)
+	return append(k, e.Server...)
+}
+
+func timeKey(t time.Time) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	return k
+}
+
+// Observe stores the result.
+func (s *Store) Observe(r results.Result) {
+	e := r.Entry()
+	value, err := json.Marshal(e)
+	if err != nil {
+		logger.Error("Failed to encode result", "server", e.Server, "type", e.Kind, "error", err)
+		return
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(resultsBucket).Put(key(e), value)
+	})
+	if err != nil {
+		logger.Error("Failed to store result", "server", e.Server, "type", e.Kind, "error", err)
+	}
+}
+
+// Query returns up to limit results since the given time, oldest first. An empty server
+// matches every server.
+func (s *Store) Query(server string, since time.Time, limit int) ([]results.Entry, error) {
+	entries := []results.Entry{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(resultsBucket).Cursor()
+		for k, v := c.Seek(timeKey(since)); k != nil && len(entries) < limit; k, v = c.Next() {
+			if server != "" && !bytes.HasSuffix(k, append([]byte{0}, server...)) {
+				continue
+			}
+			var e results.Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("corrupt history entry: %w", err)
+			}
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (s *Store) pruneLoop() {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.prune(); err != nil {
+			logger.Error("Failed to prune results", "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// prune deletes results older than the retention.
+func (s *Store) prune() error {
+	cutoff := timeKey(time.Now().Add(-s.retention))
+	return s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(resultsBucket).Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:8], cutoff) < 0; k, _ = c.Next() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
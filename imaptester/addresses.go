@@ -0,0 +1,73 @@
+package imaptester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// runAllAddresses resolves the host and runs a separate session against every address,
+// so a single bad node behind a round-robin name shows up on its own series.
+func (t *Tester) runAllAddresses(ctx context.Context) error {
+	ips, err := t.resolve(ctx)
+	if err != nil {
+		// Without a current address set, the series of the previous addresses would keep
+		// reporting their last values.
+		t.syncAddressTesters(nil)
+		return fmt.Errorf("address resolution failed: %w", err)
+	}
+
+	addresses := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, ip.String())
+	}
+	testers := t.syncAddressTesters(addresses)
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(testers))
+	for i, at := range testers {
+		wg.Add(1)
+		go func(i int, at *Tester) {
+			defer wg.Done()
+			if err := at.RunSession(ctx); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", at.address, err)
+			}
+		}(i, at)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// syncAddressTesters returns one tester per address, keeping existing ones so persistent
+// connections survive between runs. Testers for addresses that no longer resolve, or all
+// of them when resolution fails, are disconnected and their series removed.
+func (t *Tester) syncAddressTesters(addresses []string) []*Tester {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current := make(map[string]*Tester, len(addresses))
+	testers := make([]*Tester, 0, len(addresses))
+	for _, address := range addresses {
+		if _, seen := current[address]; seen {
+			continue
+		}
+		at, ok := t.addressTesters[address]
+		if !ok {
+			at = &Tester{cfg: t.cfg, address: address}
+		}
+		current[address] = at
+		testers = append(testers, at)
+	}
+
+	for address, at := range t.addressTesters {
+		if _, ok := current[address]; !ok {
+			at.disconnect()
+			deleteAddressMetrics(t.cfg.Name, address)
+		}
+	}
+	t.addressTesters = current
+
+	return testers
+}
@@ -0,0 +1,63 @@
+package imaptester
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// addressSeries returns the addresses that have a series of the server in the collector.
+func addressSeries(t *testing.T, c prometheus.Collector, server string) []string {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 100)
+	c.Collect(ch)
+	close(ch)
+
+	var addresses []string
+	for m := range ch {
+		var metric dto.Metric
+		if err := m.Write(&metric); err != nil {
+			t.Fatal(err)
+		}
+		labels := map[string]string{}
+		for _, l := range metric.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels["server"] == server {
+			addresses = append(addresses, labels["address"])
+		}
+	}
+	slices.Sort(addresses)
+	return addresses
+}
+
+func TestSyncAddressTestersDeletesSeries(t *testing.T) {
+	tester := NewTester(config.ServerConfig{Name: "round-robin", Host: "mail.example.org", ProbeAllAddresses: true})
+
+	tests := []struct {
+		name      string
+		addresses []string
+	}{
+		{"initial", []string{"192.0.2.1", "192.0.2.2"}},
+		{"address removed", []string{"192.0.2.2"}},
+		{"address added", []string{"192.0.2.2", "192.0.2.3"}},
+		// runAllAddresses syncs to no addresses when the lookup fails.
+		{"resolution failed", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, at := range tester.syncAddressTesters(tt.addresses) {
+				timeToConnect.WithLabelValues(at.cfg.Name, at.address).Set(0.01)
+				imapFailures.WithLabelValues(at.cfg.Name, at.address, "fetch", "protocol").Inc()
+			}
+			for _, c := range []prometheus.Collector{timeToConnect, imapFailures} {
+				if got := addressSeries(t, c, "round-robin"); !slices.Equal(got, tt.addresses) {
+					t.Errorf("series addresses = %v, want %v", got, tt.addresses)
+				}
+			}
+		})
+	}
+}
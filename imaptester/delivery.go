@@ -0,0 +1,252 @@
+package imaptester
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/dniminenn/mailmetrix/smtptester"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+)
+
+// DeliveryTest finds the newest message delivered by the SMTP probe in the INBOX or the
+// Junk folder, exports where it was placed and analyzes its authentication results, relay
+// hop delays and spam scores. A message that was already analyzed in a previous run is
+// skipped, leaving the metrics at their last values; if no message is found, the placement
+// is "missing".
+func (t *Tester) DeliveryTest(ctx context.Context) (err error) {
+	_, span := t.startSpan(ctx, "delivery")
+	defer func() { t.endSpan(span, "delivery", err) }()
+
+	c := t.client.Load()
+	if c == nil {
+		err := fmt.Errorf("no active connection")
+		t.handleFailure("delivery", err)
+		return err
+	}
+
+	folders := map[string]string{"inbox": "INBOX"}
+	junk, err := t.junkFolder()
+	if err != nil {
+		t.handleFailure("delivery", err)
+		return err
+	}
+	if junk != "" {
+		folders["junk"] = junk
+	}
+
+	var placement, probe string
+	var header mail.Header
+	for folder, mailbox := range folders {
+		h, err := t.newestProbe(mailbox)
+		if err != nil {
+			t.handleFailure("delivery", err)
+			return err
+		}
+		if h != nil && probeTime(h.Get(smtptester.ProbeHeader)) > probeTime(probe) {
+			placement, probe, header = folder, h.Get(smtptester.ProbeHeader), h
+		}
+	}
+	if header == nil {
+		// The probe message was deleted or never delivered, which the last placement must
+		// not hide.
+		placement = "missing"
+	} else if probe == t.lastProbe {
+		return nil
+	}
+	t.lastProbe = probe
+
+	deliveryPlacement.DeletePartialMatch(t.seriesLabels())
+	for folder := range folders {
+		deliveryPlacement.WithLabelValues(t.cfg.Name, t.address, folder).Set(boolToFloat(folder == placement))
+	}
+	deliveryPlacement.WithLabelValues(t.cfg.Name, t.address, "missing").Set(boolToFloat(placement == "missing"))
+	if placement == "missing" {
+		t.log().Warn("Probe message not found in the inbox or junk folder", "operation", "delivery")
+		return nil
+	}
+	if placement == "junk" {
+		t.log().Warn("Probe message landed in the junk folder", "operation", "delivery", "folder", junk)
+	}
+
+	t.recordDelivery(header)
+	return nil
+}
+
+type listSpecialUse struct{}
+
+func (cmd *listSpecialUse) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "LIST",
+		Arguments: []interface{}{imap.RawString("(SPECIAL-USE)"), "", "*"},
+	}
+}
+
+// junkFolder returns the mailbox carrying the \Junk special-use attribute (RFC 6154). Servers
+// without SPECIAL-USE, or without a \Junk mailbox, fall back to the configured junk folder,
+// which is "" if none is set.
+func (t *Tester) junkFolder() (string, error) {
+	c := t.client.Load()
+	if c == nil {
+		return "", fmt.Errorf("no active connection")
+	}
+
+	supported, err := c.Support("SPECIAL-USE")
+	if err != nil {
+		return "", err
+	}
+	if !supported {
+		return t.cfg.JunkFolder, nil
+	}
+
+	// The SPECIAL-USE selection option only returns the special-use mailboxes, instead of
+	// every mailbox of the account.
+	var junk string
+	var parseErr error
+	handler := responses.HandlerFunc(func(resp imap.Resp) error {
+		name, fields, ok := imap.ParseNamedResp(resp)
+		if !ok || name != "LIST" {
+			return responses.ErrUnhandled
+		}
+		m := &imap.MailboxInfo{}
+		if err := m.Parse(fields); err != nil {
+			if parseErr == nil {
+				parseErr = err
+			}
+			return nil
+		}
+		for _, attr := range m.Attributes {
+			if attr == imap.JunkAttr && junk == "" {
+				junk = m.Name
+			}
+		}
+		return nil
+	})
+
+	status, err := c.Execute(&listSpecialUse{}, handler)
+	if err == nil {
+		err = status.Err()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to list special-use mailboxes: %w", err)
+	}
+	if parseErr != nil {
+		return "", fmt.Errorf("invalid LIST response: %w", parseErr)
+	}
+	if junk == "" {
+		return t.cfg.JunkFolder, nil
+	}
+	return junk, nil
+}
+
+// newestProbe returns the header of the newest probe message in mailbox, or nil if there is none.
+// The mailbox is opened read-only so the message is not marked as seen.
+func (t *Tester) newestProbe(mailbox string) (mail.Header, error) {
+	c := t.client.Load()
+	if c == nil {
+		return nil, fmt.Errorf("no active connection")
+	}
+
+	if _, err := c.Select(mailbox, true); err != nil {
+		return nil, fmt.Errorf("failed to examine %s: %w", mailbox, err)
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Header = textproto.MIMEHeader{smtptester.ProbeHeader: {""}}
+	seqNums, err := c.Search(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("search for probe messages in %s failed: %w", mailbox, err)
+	}
+	if len(seqNums) == 0 {
+		return nil, nil
+	}
+
+	newest := seqNums[0]
+	for _, seqNum := range seqNums {
+		newest = max(newest, seqNum)
+	}
+	return t.fetchHeader(newest)
+}
+
+// probeTime returns the send time embedded in a probe header value ("name/unixnano").
+func probeTime(probe string) int64 {
+	i := strings.LastIndex(probe, "/")
+	if i < 0 {
+		return 0
+	}
+	n, _ := strconv.ParseInt(probe[i+1:], 10, 64)
+	return n
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (t *Tester) fetchHeader(seqNum uint32) (mail.Header, error) {
+	c := t.client.Load()
+	if c == nil {
+		return nil, fmt.Errorf("no active connection")
+	}
+
+	section := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier}, Peek: true}
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(seqNum)
+
+	messages := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Fetch(seqSet, []imap.FetchItem{section.FetchItem()}, messages)
+	}()
+
+	var msg *imap.Message
+	for m := range messages {
+		msg = m
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("header fetch failed: %w", err)
+	}
+	if msg == nil || msg.GetBody(section) == nil {
+		return nil, fmt.Errorf("server returned no header for message %d", seqNum)
+	}
+
+	m, err := mail.ReadMessage(msg.GetBody(section))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse header: %w", err)
+	}
+	return m.Header, nil
+}
+
+func (t *Tester) recordDelivery(header mail.Header) {
+	labels := t.seriesLabels()
+	deliveryAuthResult.DeletePartialMatch(labels)
+	deliveryHopDelay.DeletePartialMatch(labels)
+	deliverySpamScore.DeletePartialMatch(labels)
+
+	// Only the topmost Authentication-Results was added by our own receiving server.
+	if values := header["Authentication-Results"]; len(values) > 0 {
+		for _, result := range parseAuthenticationResults(values[0]) {
+			deliveryAuthResult.WithLabelValues(t.cfg.Name, t.address, result.method, result.result).Set(1)
+		}
+	}
+
+	hops := receivedHops(header)
+	previous, err := header.Date()
+	for i, hop := range hops {
+		if err == nil {
+			deliveryHopDelay.WithLabelValues(t.cfg.Name, t.address, strconv.Itoa(i), hop.by).Set(hop.time.Sub(previous).Seconds())
+		}
+		previous, err = hop.time, nil
+	}
+	deliveryHops.WithLabelValues(t.cfg.Name, t.address).Set(float64(len(hops)))
+
+	for name, score := range spamScores(header) {
+		deliverySpamScore.WithLabelValues(t.cfg.Name, t.address, name).Set(score)
+	}
+}
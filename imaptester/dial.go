@@ -0,0 +1,126 @@
+package imaptester
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const dialTimeout = 10 * time.Second
+
+// dial resolves the server host, connects to the resolved addresses in order and attempts a
+// TLS handshake, timing each phase separately. It falls back to plaintext if TLS fails.
+// A tester pinned to a single address skips the lookup and dials only that address.
+//
+// The fallback is expected for plaintext servers, so a failed handshake only marks the tls
+// span with error.type "tls" and leaves the TLS timing NaN; it is not counted in
+// imap_failures_total, which therefore never reports the tls reason.
+func (t *Tester) dial(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	var ips []net.IP
+	if t.address != "" {
+		ips = []net.IP{net.ParseIP(t.address)}
+	} else {
+		var err error
+		if ips, err = t.resolve(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := t.connect(ctx, ips)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         t.cfg.Host,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+	})
+
+	_, span := t.startSpan(ctx, "tls")
+	start := time.Now()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		timeToTLSHandshake.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+		t.endSpan(span, "tls", err)
+		return t.connect(ctx, ips)
+	}
+	t.observe(timeToTLSHandshake, "tls", time.Since(start))
+	state := tlsConn.ConnectionState()
+	t.session.Load().SetTLS(state)
+	span.SetAttributes(
+		attribute.String("tls.protocol.version", tls.VersionName(state.Version)),
+		attribute.String("tls.cipher", tls.CipherSuiteName(state.CipherSuite)),
+	)
+	t.endSpan(span, "tls", nil)
+
+	return tlsConn, nil
+}
+
+// resolve looks up the host addresses, restricted to the configured IP family.
+func (t *Tester) resolve(ctx context.Context) ([]net.IP, error) {
+	network := "ip"
+	switch t.cfg.IPFamily {
+	case "ipv4":
+		network = "ip4"
+	case "ipv6":
+		network = "ip6"
+	}
+
+	_, span := t.startSpan(ctx, "dns")
+	start := time.Now()
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, t.cfg.Host)
+	if err != nil {
+		t.handleFailure("dns", err)
+		t.endSpan(span, "dns", err)
+		return nil, fmt.Errorf("failed to resolve %s: %w", t.cfg.Host, err)
+	}
+	t.observe(timeToDNS, "dns", time.Since(start))
+	span.SetAttributes(attribute.Int("dns.addresses", len(ips)))
+	t.endSpan(span, "dns", nil)
+	return ips, nil
+}
+
+// connect tries each resolved address in order and returns the first successful connection.
+// Like the other timings, the connect time is labelled with the pinned address; every
+// attempted address appears as its own step in the session details, and probe_all_addresses
+// gives each address its own series.
+func (t *Tester) connect(ctx context.Context, ips []net.IP) (conn net.Conn, err error) {
+	_, span := t.startSpan(ctx, "dial")
+	defer func() { t.endSpan(span, "connect", err) }()
+
+	dialer := &net.Dialer{}
+	port := strconv.Itoa(t.cfg.Port)
+
+	var lastErr error
+	for _, addr := range ips {
+		ip := addr.String()
+
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, port))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		timeToConnect.WithLabelValues(t.cfg.Name, t.address).Set(time.Since(start).Seconds())
+		t.session.Load().Step(fmt.Sprintf("connect [%s]", ip), time.Since(start))
+		span.SetAttributes(semconv.NetworkPeerAddress(ip))
+		return conn, nil
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no addresses found for %s", t.cfg.Host)
+	}
+	t.handleFailure("connect", lastErr)
+	return nil, fmt.Errorf("failed to connect to %s: %w", t.cfg.Host, lastErr)
+}
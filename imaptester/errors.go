@@ -0,0 +1,140 @@
+package imaptester
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/dniminenn/mailmetrix/errclass"
+)
+
+// maxStatusLine bounds how much of a server line is buffered while looking for tagged
+// status responses; longer lines are literal data and are skipped.
+const maxStatusLine = 1024
+
+// authCodes are the RFC 5530 response codes that mean the credentials or account are at fault.
+var authCodes = map[string]bool{
+	"AUTHENTICATIONFAILED": true,
+	"AUTHORIZATIONFAILED":  true,
+	"EXPIRED":              true,
+	"PRIVACYREQUIRED":      true,
+	"CONTACTADMIN":         true,
+}
+
+// statusConn records the response code and text of the last tagged NO or BAD response.
+// go-imap only returns the text of a failed command, so the code is taken from the wire.
+type statusConn struct {
+	net.Conn
+
+	mu    sync.Mutex
+	line  []byte
+	skip  bool
+	first string
+	last  string
+	code  string
+	info  string
+}
+
+func (c *statusConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for data := p[:n]; len(data) > 0; {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			c.buffer(data)
+			break
+		}
+		c.buffer(data[:i])
+		if !c.skip {
+			line := strings.TrimRight(string(c.line), "\r")
+			if c.first == "" {
+				c.first = line
+			}
+			c.parse(line)
+		}
+		c.line, c.skip = c.line[:0], false
+		data = data[i+1:]
+	}
+	return n, err
+}
+
+func (c *statusConn) buffer(data []byte) {
+	if c.skip || len(c.line)+len(data) > maxStatusLine {
+		c.skip = true
+		return
+	}
+	c.line = append(c.line, data...)
+}
+
+// parse handles `tag OK|NO|BAD [CODE ...] text`; untagged and continuation lines are ignored.
+func (c *statusConn) parse(line string) {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 || fields[0] == "*" || fields[0] == "+" {
+		return
+	}
+	switch strings.ToUpper(fields[1]) {
+	case "OK":
+		c.code, c.info = "", ""
+	case "NO", "BAD":
+		c.code, c.info, c.last = "", "", line
+		if len(fields) < 3 {
+			return
+		}
+		text := fields[2]
+		if strings.HasPrefix(text, "[") {
+			if end := strings.IndexByte(text, ']'); end > 0 {
+				code, _, _ := strings.Cut(text[1:end], " ")
+				c.code = strings.ToUpper(code)
+				text = strings.TrimSpace(text[end+1:])
+			}
+		}
+		c.info = text
+	}
+}
+
+// lastFailure returns the code, text and full line of the last tagged NO or BAD response.
+func (c *statusConn) lastFailure() (string, string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.code, c.info, c.last
+}
+
+// greeting returns the first line the server sent.
+func (c *statusConn) greeting() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.first
+}
+
+// serverResponse returns the tagged NO or BAD line that err was created from, if any.
+func (t *Tester) serverResponse(err error) (string, bool) {
+	conn := t.conn.Load()
+	if conn == nil {
+		return "", false
+	}
+	_, info, line := conn.lastFailure()
+	if info == "" || !strings.Contains(err.Error(), info) {
+		return "", false
+	}
+	return line, true
+}
+
+// classify returns the failure reason. Server NO/BAD responses are matched by their text
+// to the response code read from the connection, so RFC 5530 auth codes are reported as
+// auth failures; a rejected login without a code is one as well.
+func (t *Tester) classify(operation string, err error) string {
+	if reason := errclass.Classify(err); reason != errclass.Protocol {
+		return reason
+	}
+	if conn := t.conn.Load(); conn != nil {
+		if code, info, _ := conn.lastFailure(); info != "" && strings.Contains(err.Error(), info) {
+			if authCodes[code] || operation == "authentication" {
+				return errclass.Auth
+			}
+		}
+	}
+	return errclass.Protocol
+}
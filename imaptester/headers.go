@@ -0,0 +1,99 @@
+package imaptester
+
+import (
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// authResult is a single method=result pair from an Authentication-Results header.
+type authResult struct {
+	method string
+	result string
+}
+
+// parseAuthenticationResults parses an RFC 8601 Authentication-Results value, skipping the
+// authserv-id and ignoring the properties after each result.
+func parseAuthenticationResults(value string) []authResult {
+	parts := strings.Split(value, ";")
+	var results []authResult
+	for _, part := range parts[1:] {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		method, result, ok := strings.Cut(fields[0], "=")
+		if !ok || method == "" || result == "" {
+			continue
+		}
+		results = append(results, authResult{
+			method: strings.ToLower(method),
+			result: strings.ToLower(result),
+		})
+	}
+	return results
+}
+
+// receivedHop is one Received header, with the host that added it and when.
+type receivedHop struct {
+	by   string
+	time time.Time
+}
+
+// parseReceived extracts the "by" host and the timestamp after the final semicolon.
+func parseReceived(value string) (receivedHop, bool) {
+	i := strings.LastIndex(value, ";")
+	if i < 0 {
+		return receivedHop{}, false
+	}
+	date, err := mail.ParseDate(strings.TrimSpace(value[i+1:]))
+	if err != nil {
+		return receivedHop{}, false
+	}
+
+	hop := receivedHop{time: date}
+	fields := strings.Fields(value[:i])
+	for j := 0; j < len(fields)-1; j++ {
+		if strings.EqualFold(fields[j], "by") {
+			hop.by = strings.ToLower(fields[j+1])
+			break
+		}
+	}
+	return hop, true
+}
+
+// receivedHops returns the Received hops in delivery order. Headers are prepended by each
+// relay, so the header list runs from the last hop to the first.
+func receivedHops(header mail.Header) []receivedHop {
+	values := header["Received"]
+	hops := make([]receivedHop, 0, len(values))
+	for i := len(values) - 1; i >= 0; i-- {
+		if hop, ok := parseReceived(values[i]); ok {
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// spamScores returns the scores from the spam filter headers that are present.
+func spamScores(header mail.Header) map[string]float64 {
+	scores := make(map[string]float64)
+	for _, name := range []string{"X-Spam-Score", "X-Rspamd-Score"} {
+		if score, err := strconv.ParseFloat(strings.TrimSpace(header.Get(name)), 64); err == nil {
+			scores[strings.ToLower(name)] = score
+		}
+	}
+
+	// SpamAssassin may only report the score inside X-Spam-Status: "Yes, score=5.1 required=5.0 ..."
+	if _, ok := scores["x-spam-score"]; !ok {
+		for _, field := range strings.Fields(header.Get("X-Spam-Status")) {
+			if value, ok := strings.CutPrefix(field, "score="); ok {
+				if score, err := strconv.ParseFloat(value, 64); err == nil {
+					scores["x-spam-score"] = score
+				}
+			}
+		}
+	}
+	return scores
+}
@@ -2,23 +2,43 @@ package imaptester
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
-	"log"
 	"math"
-	"net"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/results"
+	"github.com/dniminenn/mailmetrix/tracing"
+	"github.com/dniminenn/mailmetrix/transcript"
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Tester struct {
-	cfg    config.ServerConfig
-	client atomic.Pointer[client.Client]
+	cfg config.ServerConfig
+	// address pins the tester to a single resolved IP when probing every address of the host.
+	address string
+	client  atomic.Pointer[client.Client]
+	// conn is the connection under client, read for the response codes of failed commands.
+	conn atomic.Pointer[statusConn]
+	// session collects the step details of the current run for the result history.
+	session atomic.Pointer[results.Session]
+	// transcript records the protocol exchange of the current run in debug mode.
+	transcript atomic.Pointer[transcript.Transcript]
+
+	// connectedAt holds the UnixNano time the persistent connection was established, zero if none yet.
+	connectedAt atomic.Int64
+
+	mu             sync.Mutex
+	addressTesters map[string]*Tester
+
+	// lastProbe is the probe header of the last delivered message analyzed by DeliveryTest.
+	lastProbe string
 }
 
 func (t *Tester) GetName() string {
@@ -29,79 +49,123 @@ func NewTester(cfg config.ServerConfig) *Tester {
 	return &Tester{cfg: cfg}
 }
 
+// seriesLabels returns the labels identifying this tester's series, for partial-match deletion.
+func (t *Tester) seriesLabels() prometheus.Labels {
+	if t.address == "" {
+		return prometheus.Labels{"server": t.cfg.Name}
+	}
+	return prometheus.Labels{"server": t.cfg.Name, "address": t.address}
+}
+
+// stepName returns the operation name used in the session details, with the pinned address.
+func (t *Tester) stepName(operation string) string {
+	if t.address == "" {
+		return operation
+	}
+	return fmt.Sprintf("%s [%s]", operation, t.address)
+}
+
+// observe sets the timing gauge of a successful operation and records it in the session.
+func (t *Tester) observe(gauge *prometheus.GaugeVec, operation string, d time.Duration) {
+	gauge.WithLabelValues(t.cfg.Name, t.address).Set(d.Seconds())
+	t.session.Load().Step(t.stepName(operation), d)
+	t.log().Debug("Operation succeeded", "operation", operation, "duration", d)
+}
+
 // If we don't clean up stale metrics, Prometheus will keep reporting the last value indefinitely.
 func (t *Tester) handleFailure(operation string, err error) {
-	log.Printf("[ERROR] %s failed for %s: %v", operation, t.cfg.Name, err)
-	imapFailures.WithLabelValues(t.cfg.Name, operation).Inc()
+	reason := t.classify(operation, err)
+	t.log().Error("Operation failed", "operation", operation, "error_class", reason, "error", err)
+	imapFailures.WithLabelValues(t.cfg.Name, t.address, operation, reason).Inc()
+	t.session.Load().Fail(t.stepName(operation), reason, err)
+	if response, ok := t.serverResponse(err); ok {
+		t.session.Load().Snippet(response)
+	}
 	t.resetMetricsForOperation(operation)
 }
 
 func (t *Tester) resetMetricsForOperation(operation string) {
 	switch operation {
 	case "authentication":
-		timeToAuth.WithLabelValues(t.cfg.Name).Set(math.NaN())
+		timeToAuth.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
 	case "fetch":
-		timeToFetch.WithLabelValues(t.cfg.Name).Set(math.NaN())
+		timeToFetch.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
 	case "append":
-		timeToAppend.WithLabelValues(t.cfg.Name).Set(math.NaN())
+		timeToAppend.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
 	case "expunge":
-		timeToExpunge.WithLabelValues(t.cfg.Name).Set(math.NaN())
+		timeToExpunge.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
 	case "banner":
-		timeToBanner.WithLabelValues(t.cfg.Name).Set(math.NaN())
+		timeToBanner.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+	case "dns":
+		timeToDNS.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+	case "connect":
+		timeToConnect.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+	case "noop":
+		timeToNoop.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+	case "status":
+		timeToStatus.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+	case "usage":
+		quotaUsage.DeletePartialMatch(t.seriesLabels())
+		quotaLimit.DeletePartialMatch(t.seriesLabels())
+		folderMessages.DeletePartialMatch(t.seriesLabels())
+		folderUnseen.DeletePartialMatch(t.seriesLabels())
 	case "session":
-		timeToAuth.WithLabelValues(t.cfg.Name).Set(math.NaN())
-		timeToFetch.WithLabelValues(t.cfg.Name).Set(math.NaN())
-		timeToAppend.WithLabelValues(t.cfg.Name).Set(math.NaN())
-		timeToExpunge.WithLabelValues(t.cfg.Name).Set(math.NaN())
-		timeToBanner.WithLabelValues(t.cfg.Name).Set(math.NaN())
+		timeToAuth.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+		timeToFetch.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+		timeToAppend.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+		timeToExpunge.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+		timeToBanner.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+		timeToDNS.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+		timeToTLSHandshake.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+		timeToConnect.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+		t.resetMetricsForOperation("usage")
+		if t.cfg.Persistent {
+			timeToNoop.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+			timeToStatus.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+			connectionAge.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+		}
 	}
 }
 
 // Authenticate establishes a connection to the IMAP server and logs in with the provided credentials.
 // It automatically falls back to plaintext if the server does not support TLS.
-func (t *Tester) Authenticate() error {
+func (t *Tester) Authenticate(ctx context.Context) error {
 	if t.client.Load() != nil {
 		return fmt.Errorf("connection already exists")
 	}
 
-	address := fmt.Sprintf("%s:%d", t.cfg.Host, t.cfg.Port)
-	dialer := &net.Dialer{Timeout: 10 * time.Second}
-
-	tlsConfig := &tls.Config{
-		ServerName:         t.cfg.Host,
-		InsecureSkipVerify: true,
-		MinVersion:         tls.VersionTLS12,
-	}
-
-	var conn net.Conn
-	var err error
-
-	conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	raw, err := t.dial(ctx)
 	if err != nil {
-		conn, err = dialer.Dial("tcp", address)
-		if err != nil {
-			t.handleFailure("banner", err)
-			return fmt.Errorf("failed to connect to %s: %w", address, err)
-		}
+		return err
 	}
+	conn := &statusConn{Conn: raw}
+	t.conn.Store(conn)
 
+	_, span := t.startSpan(ctx, "banner")
 	start := time.Now()
 	c, err := client.New(conn)
 	if err != nil {
 		t.handleFailure("banner", err)
+		t.endSpan(span, "banner", err)
 		return fmt.Errorf("failed to initialize IMAP client: %w", err)
 	}
-	timeToBanner.WithLabelValues(t.cfg.Name).Set(time.Since(start).Seconds())
+	t.observe(timeToBanner, "banner", time.Since(start))
+	t.endSpan(span, "banner", nil)
+	t.session.Load().Snippet(conn.greeting())
+	t.enableTranscript(c, conn.greeting())
 
+	_, span = t.startSpan(ctx, "login")
 	start = time.Now()
 	if err = c.Login(t.cfg.Username, t.cfg.Password); err != nil {
 		t.handleFailure("authentication", err)
+		t.endSpan(span, "authentication", err)
 		c.Logout()
 		return fmt.Errorf("login failed: %w", err)
 	}
 
 	t.client.Store(c)
-	timeToAuth.WithLabelValues(t.cfg.Name).Set(time.Since(start).Seconds())
+	t.observe(timeToAuth, "authentication", time.Since(start))
+	t.endSpan(span, "authentication", nil)
 	return nil
 }
 
@@ -115,21 +179,26 @@ func (t *Tester) FetchTest(ctx context.Context) error {
 	}
 
 	start := time.Now()
+	_, span := t.startSpan(ctx, "select", attribute.String("imap.mailbox", "INBOX"))
 	mbox, err := c.Select("INBOX", false)
 	if err != nil {
 		t.handleFailure("fetch", err)
+		t.endSpan(span, "fetch", err)
 		return fmt.Errorf("failed to select INBOX: %w", err)
 	}
+	span.SetAttributes(attribute.Int("imap.mailbox.messages", int(mbox.Messages)))
+	t.endSpan(span, "fetch", nil)
 
 	if mbox.Messages == 0 {
-		log.Println("[IMAP] No messages in INBOX")
-		timeToFetch.WithLabelValues(t.cfg.Name).Set(0)
+		t.log().Debug("No messages in INBOX", "operation", "fetch")
+		timeToFetch.WithLabelValues(t.cfg.Name, t.address).Set(0)
 		return nil
 	}
 
 	seqSet := new(imap.SeqSet)
 	seqSet.AddRange(1, mbox.Messages)
 
+	_, span = t.startSpan(ctx, "fetch")
 	messages := make(chan *imap.Message, 10)
 	done := make(chan error, 1)
 
@@ -137,16 +206,20 @@ func (t *Tester) FetchTest(ctx context.Context) error {
 		done <- c.Fetch(seqSet, []imap.FetchItem{imap.FetchEnvelope}, messages)
 	}()
 
-	for msg := range messages {
-		_ = msg
+	fetched := 0
+	for range messages {
+		fetched++
 	}
+	span.SetAttributes(attribute.Int("imap.fetch.messages", fetched))
 
 	if err := <-done; err != nil {
 		t.handleFailure("fetch", err)
+		t.endSpan(span, "fetch", err)
 		return fmt.Errorf("fetch failed: %w", err)
 	}
 
-	timeToFetch.WithLabelValues(t.cfg.Name).Set(time.Since(start).Seconds())
+	t.observe(timeToFetch, "fetch", time.Since(start))
+	t.endSpan(span, "fetch", nil)
 	return nil
 }
 
@@ -160,22 +233,46 @@ func (t *Tester) AppendTest(ctx context.Context) error {
 	}
 
 	start := time.Now()
+	// The Message-ID identifies the appended message for the cleanup, so no other message
+	// is ever deleted.
+	messageID := fmt.Sprintf("<%d.append@mailmetrix.example.org>", start.UnixNano())
 	testMessage := "From: jr@mailmetrix.example.org\r\n" +
 		"To: rj@mailmetrix.example.org\r\n" +
 		"Subject: mailmetrix-test\r\n" +
+		"Message-ID: " + messageID + "\r\n" +
 		"\r\n" +
 		"This is a test message for IMAP testing purposes.\r\n"
 
+	_, span := t.startSpan(ctx, "append", attribute.Int("imap.message.size", len(testMessage)))
 	if err := c.Append("INBOX", nil, time.Now(), strings.NewReader(testMessage)); err != nil {
 		t.handleFailure("append", err)
+		t.endSpan(span, "append", err)
 		return fmt.Errorf("append failed: %w", err)
 	}
 
-	timeToAppend.WithLabelValues(t.cfg.Name).Set(time.Since(start).Seconds())
-	return t.cleanupTestMessage()
+	t.observe(timeToAppend, "append", time.Since(start))
+	t.endSpan(span, "append", nil)
+	return t.cleanupTestMessage(ctx, messageID)
+}
+
+type uidExpunge struct {
+	uids *imap.SeqSet
+}
+
+func (cmd *uidExpunge) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "UID",
+		Arguments: []interface{}{imap.RawString("EXPUNGE"), cmd.uids},
+	}
 }
 
-func (t *Tester) cleanupTestMessage() error {
+// cleanupTestMessage deletes the appended message with the given Message-ID. With UIDPLUS
+// only that message is expunged; otherwise EXPUNGE also removes messages another client
+// marked deleted.
+func (t *Tester) cleanupTestMessage(ctx context.Context, messageID string) (err error) {
+	_, span := t.startSpan(ctx, "expunge")
+	defer func() { t.endSpan(span, "expunge", err) }()
+
 	c := t.client.Load()
 	if c == nil {
 		err := fmt.Errorf("no active connection")
@@ -189,43 +286,124 @@ func (t *Tester) cleanupTestMessage() error {
 		return fmt.Errorf("cleanup select failed: %w", err)
 	}
 
-	if mbox.Messages <= 1 {
-		log.Println("[IMAP] Only one or no message present. Skipping cleanup.")
+	if mbox.Messages == 0 {
+		t.log().Debug("No message present, skipping cleanup", "operation", "expunge")
 		return nil
 	}
 
-	seqSet := new(imap.SeqSet)
-	seqSet.AddRange(1, mbox.Messages-1)
+	criteria := imap.NewSearchCriteria()
+	criteria.Header.Add("Message-ID", messageID)
+	found, err := c.UidSearch(criteria)
+	if err != nil {
+		t.handleFailure("expunge", err)
+		return fmt.Errorf("failed to search the appended message: %w", err)
+	}
+	if len(found) == 0 {
+		t.log().Warn("Appended message not found, skipping cleanup", "operation", "expunge")
+		return nil
+	}
+
+	uids := new(imap.SeqSet)
+	uids.AddNum(found...)
+	span.SetAttributes(attribute.Int("imap.expunge.messages", len(found)))
 
-	if err := c.Store(seqSet, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag}, nil); err != nil {
+	if err := c.UidStore(uids, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag}, nil); err != nil {
 		t.handleFailure("expunge", err)
 		return fmt.Errorf("failed to mark messages as deleted: %w", err)
 	}
 
+	uidPlus, err := c.Support("UIDPLUS")
+	if err != nil {
+		t.handleFailure("expunge", err)
+		return err
+	}
 	start := time.Now()
-	if err := c.Expunge(nil); err != nil {
+	if uidPlus {
+		var status *imap.StatusResp
+		if status, err = c.Execute(&uidExpunge{uids: uids}, nil); err == nil {
+			err = status.Err()
+		}
+	} else {
+		err = c.Expunge(nil)
+	}
+	if err != nil {
 		t.handleFailure("expunge", err)
 		return fmt.Errorf("failed to expunge messages: %w", err)
 	}
 
-	timeToExpunge.WithLabelValues(t.cfg.Name).Set(time.Since(start).Seconds())
+	t.observe(timeToExpunge, "expunge", time.Since(start))
+	return nil
+}
+
+// disconnect logs out and drops the current connection, if any.
+func (t *Tester) disconnect() {
+	if c := t.client.Swap(nil); c != nil {
+		c.Logout()
+	}
+	// Whatever dropped the connection, its age no longer means anything.
+	if t.cfg.Persistent {
+		connectionAge.WithLabelValues(t.cfg.Name, t.address).Set(math.NaN())
+	}
+}
+
+// Close logs out of the persistent connections when the tester is no longer scheduled.
+func (t *Tester) Close() error {
+	t.mu.Lock()
+	for _, at := range t.addressTesters {
+		at.disconnect()
+	}
+	t.mu.Unlock()
+	t.disconnect()
 	return nil
 }
 
 // RunSession runs the IMAP test session.
-func (t *Tester) RunSession(ctx context.Context) error {
+func (t *Tester) RunSession(ctx context.Context) (err error) {
+	ctx, span := t.startSpan(ctx, "session", attribute.Bool("imap.persistent", t.cfg.Persistent))
+	defer func() {
+		// The session span carries the reason of the failed step, as the session result does.
+		if reason := t.session.Load().Reason(); err != nil && reason != "" {
+			tracing.Fail(span, reason, err)
+			span.End()
+			return
+		}
+		t.endSpan(span, "session", err)
+	}()
+
+	t.session.Store(results.FromContext(ctx))
+	tr := transcript.FromContext(ctx)
+	tr.Mask(t.cfg.Password)
+	t.transcript.Store(tr)
+	if t.cfg.ProbeAllAddresses && t.address == "" {
+		return t.runAllAddresses(ctx)
+	}
+	if t.cfg.Persistent {
+		return t.runPersistentSession(ctx)
+	}
+
 	errChan := make(chan error, 1)
 
 	go func() {
-		if err := t.Authenticate(); err != nil {
+		if err := t.Authenticate(ctx); err != nil {
 			errChan <- fmt.Errorf("authentication failed: %w", err)
 			return
 		}
-		defer func() {
-			if c := t.client.Swap(nil); c != nil {
-				c.Logout()
+		defer t.disconnect()
+
+		if t.cfg.AnalyzeDelivery {
+			if err := t.DeliveryTest(ctx); err != nil {
+				errChan <- fmt.Errorf("delivery test failed: %w", err)
+				return
 			}
-		}()
+		}
+
+		percent, err := t.UsageTest(ctx)
+		if err != nil {
+			errChan <- fmt.Errorf("usage test failed: %w", err)
+			return
+		}
+		t.warnQuota(percent)
+
 		if err := t.AppendTest(ctx); err != nil {
 			errChan <- fmt.Errorf("append test failed: %w", err)
 			return
@@ -242,9 +420,7 @@ func (t *Tester) RunSession(ctx context.Context) error {
 	case err := <-errChan:
 		return err
 	case <-ctx.Done():
-		if c := t.client.Swap(nil); c != nil {
-			c.Logout()
-		}
+		t.disconnect()
 		err := fmt.Errorf("session timed out: %w", ctx.Err())
 		t.handleFailure("session", err)
 		return err
@@ -0,0 +1,17 @@
+package imaptester
+
+import (
+	"log/slog"
+
+	"github.com/dniminenn/mailmetrix/logging"
+)
+
+var logger = logging.New("imap")
+
+// log returns the logger with the attributes identifying this tester.
+func (t *Tester) log() *slog.Logger {
+	if t.address == "" {
+		return logger.With("server", t.cfg.Name, "type", "imap")
+	}
+	return logger.With("server", t.cfg.Name, "address", t.address, "type", "imap")
+}
@@ -1,19 +1,41 @@
 package imaptester
 
 import (
-	"log"
-
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
+	timeToDNS = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_dns_lookup_seconds",
+			Help:      "Time to resolve the IMAP server hostname",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address"},
+	)
+	timeToConnect = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_tcp_connect_seconds",
+			Help:      "Time to establish the TCP connection to the IMAP server",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address"},
+	)
+	timeToTLSHandshake = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_tls_handshake_seconds",
+			Help:      "Time to complete the TLS handshake with the IMAP server",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address"},
+	)
 	timeToBanner = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name:      "imap_time_to_banner_seconds",
 			Help:      "Time to receive IMAP banner",
 			Namespace: "mailmetrix",
 		},
-		[]string{"server"},
+		[]string{"server", "address"},
 	)
 	timeToAuth = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -21,7 +43,7 @@ var (
 			Help:      "Time to authenticate to IMAP server",
 			Namespace: "mailmetrix",
 		},
-		[]string{"server"},
+		[]string{"server", "address"},
 	)
 	timeToFetch = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -29,7 +51,7 @@ var (
 			Help:      "Time to fetch messages from IMAP server",
 			Namespace: "mailmetrix",
 		},
-		[]string{"server"},
+		[]string{"server", "address"},
 	)
 	timeToAppend = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -37,7 +59,7 @@ var (
 			Help:      "Time to append message to IMAP server",
 			Namespace: "mailmetrix",
 		},
-		[]string{"server"},
+		[]string{"server", "address"},
 	)
 	timeToExpunge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -45,25 +67,177 @@ var (
 			Help:      "Time to expunge messages from IMAP server",
 			Namespace: "mailmetrix",
 		},
-		[]string{"server"},
+		[]string{"server", "address"},
+	)
+	timeToNoop = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_time_to_noop_seconds",
+			Help:      "Time to run NOOP on a persistent IMAP connection",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address"},
+	)
+	timeToStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_time_to_status_seconds",
+			Help:      "Time to run STATUS on a persistent IMAP connection",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address"},
+	)
+	connectionAge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_connection_age_seconds",
+			Help:      "Age of the persistent IMAP connection",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address"},
+	)
+	imapReconnects = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "imap_reconnects_total",
+			Help:      "Total number of persistent IMAP connection re-establishments",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address"},
+	)
+	deliveryAuthResult = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_delivery_auth_result",
+			Help:      "Authentication-Results of the last delivered probe message, by method and result",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address", "method", "result"},
+	)
+	deliveryHopDelay = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_delivery_hop_delay_seconds",
+			Help:      "Delay of each Received hop of the last delivered probe message",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address", "hop", "by"},
+	)
+	deliveryHops = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_delivery_hops",
+			Help:      "Number of Received hops of the last delivered probe message",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address"},
+	)
+	deliverySpamScore = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_delivery_spam_score",
+			Help:      "Spam score of the last delivered probe message, by header",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address", "header"},
+	)
+	deliveryPlacement = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "delivery_placement",
+			Help:      "Whether the last delivered probe message landed in the folder (1) or not (0); the missing folder is 1 when no probe message was found",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address", "folder"},
+	)
+	quotaUsage = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_quota_usage",
+			Help:      "Current usage of a quota resource of the INBOX quota roots (STORAGE in bytes)",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address", "root", "resource"},
+	)
+	quotaLimit = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_quota_limit",
+			Help:      "Limit of a quota resource of the INBOX quota roots (STORAGE in bytes)",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address", "root", "resource"},
+	)
+	folderMessages = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_folder_messages",
+			Help:      "Number of messages in the folder",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address", "folder"},
+	)
+	folderUnseen = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "imap_folder_unseen",
+			Help:      "Number of unseen messages in the folder",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address", "folder"},
 	)
 	imapFailures = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name:      "imap_failures_total",
-			Help:      "Total number of IMAP operation failures",
+			Help:      "Total number of IMAP operation failures by reason",
 			Namespace: "mailmetrix",
 		},
-		[]string{"server", "operation"},
+		[]string{"server", "address", "operation", "reason"},
 	)
 )
 
+// deleteAddressMetrics removes every series of an address that no longer resolves for the server.
+func deleteAddressMetrics(server, address string) {
+	labels := prometheus.Labels{"server": server, "address": address}
+	vecs := []*prometheus.MetricVec{
+		timeToDNS.MetricVec,
+		timeToConnect.MetricVec,
+		timeToTLSHandshake.MetricVec,
+		timeToBanner.MetricVec,
+		timeToAuth.MetricVec,
+		timeToFetch.MetricVec,
+		timeToAppend.MetricVec,
+		timeToExpunge.MetricVec,
+		timeToNoop.MetricVec,
+		timeToStatus.MetricVec,
+		connectionAge.MetricVec,
+		imapReconnects.MetricVec,
+		deliveryAuthResult.MetricVec,
+		deliveryHopDelay.MetricVec,
+		deliveryHops.MetricVec,
+		deliverySpamScore.MetricVec,
+		deliveryPlacement.MetricVec,
+		quotaUsage.MetricVec,
+		quotaLimit.MetricVec,
+		folderMessages.MetricVec,
+		folderUnseen.MetricVec,
+		imapFailures.MetricVec,
+	}
+	for _, vec := range vecs {
+		vec.DeletePartialMatch(labels)
+	}
+}
+
 func init() {
 	metrics := []prometheus.Collector{
+		timeToDNS,
+		timeToConnect,
+		timeToTLSHandshake,
 		timeToBanner,
 		timeToAuth,
 		timeToFetch,
 		timeToAppend,
 		timeToExpunge,
+		timeToNoop,
+		timeToStatus,
+		connectionAge,
+		imapReconnects,
+		deliveryAuthResult,
+		deliveryHopDelay,
+		deliveryHops,
+		deliverySpamScore,
+		deliveryPlacement,
+		quotaUsage,
+		quotaLimit,
+		folderMessages,
+		folderUnseen,
 		imapFailures,
 	}
 
@@ -73,7 +247,7 @@ func init() {
 				prometheus.Unregister(are.ExistingCollector)
 				prometheus.MustRegister(metric)
 			} else {
-				log.Printf("Error registering metric: %v", err)
+				logger.Error("Error registering metric", "error", err)
 			}
 		}
 	}
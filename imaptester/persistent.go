@@ -0,0 +1,132 @@
+package imaptester
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// runPersistentSession reuses the logged-in connection from the previous run, so the timings
+// reflect steady-state command latency rather than connect and login cost.
+// Any failure drops the connection and the next run reconnects.
+func (t *Tester) runPersistentSession(ctx context.Context) error {
+	errChan := make(chan error, 1)
+
+	go func() {
+		if err := t.ensureConnected(ctx); err != nil {
+			errChan <- fmt.Errorf("authentication failed: %w", err)
+			return
+		}
+
+		if err := t.NoopTest(ctx); err != nil {
+			t.disconnect()
+			errChan <- fmt.Errorf("noop test failed: %w", err)
+			return
+		}
+
+		if err := t.StatusTest(ctx); err != nil {
+			t.disconnect()
+			errChan <- fmt.Errorf("status test failed: %w", err)
+			return
+		}
+
+		if _, err := t.UsageTest(ctx); err != nil {
+			t.disconnect()
+			errChan <- fmt.Errorf("usage test failed: %w", err)
+			return
+		}
+
+		if t.cfg.AnalyzeDelivery {
+			if err := t.DeliveryTest(ctx); err != nil {
+				t.disconnect()
+				errChan <- fmt.Errorf("delivery test failed: %w", err)
+				return
+			}
+		}
+
+		if err := t.FetchTest(ctx); err != nil {
+			t.disconnect()
+			errChan <- fmt.Errorf("fetch test failed: %w", err)
+			return
+		}
+
+		connectionAge.WithLabelValues(t.cfg.Name, t.address).Set(time.Since(time.Unix(0, t.connectedAt.Load())).Seconds())
+		errChan <- nil
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		t.disconnect()
+		err := fmt.Errorf("session timed out: %w", ctx.Err())
+		t.handleFailure("session", err)
+		return err
+	}
+}
+
+// ensureConnected reuses the existing connection if the server has not closed it,
+// otherwise it dials and logs in again.
+func (t *Tester) ensureConnected(ctx context.Context) error {
+	if c := t.client.Load(); c != nil {
+		if c.State() != imap.LogoutState {
+			return nil
+		}
+		t.client.CompareAndSwap(c, nil)
+	}
+
+	if err := t.Authenticate(ctx); err != nil {
+		return err
+	}
+
+	if t.connectedAt.Swap(time.Now().UnixNano()) != 0 {
+		imapReconnects.WithLabelValues(t.cfg.Name, t.address).Inc()
+	}
+	return nil
+}
+
+// NoopTest sends a NOOP on the current connection.
+func (t *Tester) NoopTest(ctx context.Context) (err error) {
+	_, span := t.startSpan(ctx, "noop")
+	defer func() { t.endSpan(span, "noop", err) }()
+
+	c := t.client.Load()
+	if c == nil {
+		err := fmt.Errorf("no active connection")
+		t.handleFailure("noop", err)
+		return err
+	}
+
+	start := time.Now()
+	if err := c.Noop(); err != nil {
+		t.handleFailure("noop", err)
+		return fmt.Errorf("noop failed: %w", err)
+	}
+
+	t.observe(timeToNoop, "noop", time.Since(start))
+	return nil
+}
+
+// StatusTest requests the message and unseen counts of the INBOX.
+func (t *Tester) StatusTest(ctx context.Context) (err error) {
+	_, span := t.startSpan(ctx, "status")
+	defer func() { t.endSpan(span, "status", err) }()
+
+	c := t.client.Load()
+	if c == nil {
+		err := fmt.Errorf("no active connection")
+		t.handleFailure("status", err)
+		return err
+	}
+
+	start := time.Now()
+	if _, err := c.Status("INBOX", []imap.StatusItem{imap.StatusMessages, imap.StatusUnseen}); err != nil {
+		t.handleFailure("status", err)
+		return fmt.Errorf("status failed: %w", err)
+	}
+
+	t.observe(timeToStatus, "status", time.Since(start))
+	return nil
+}
@@ -0,0 +1,32 @@
+package imaptester
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/results"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDisconnectResetsConnectionAge(t *testing.T) {
+	port := newFakeServer(t)
+	tester := NewTester(config.ServerConfig{
+		Name: "persistent", Host: "127.0.0.1", Port: port, Username: "username", Password: "password",
+		Persistent: true,
+	})
+	ctx, _ := results.NewContext(context.Background())
+	if err := tester.RunSession(ctx); err != nil {
+		t.Fatalf("RunSession() = %v", err)
+	}
+	age := connectionAge.WithLabelValues("persistent", "")
+	if got := testutil.ToFloat64(age); math.IsNaN(got) || got < 0 {
+		t.Fatalf("connection age = %v after a session, want a duration", got)
+	}
+
+	tester.Close()
+	if got := testutil.ToFloat64(age); !math.IsNaN(got) {
+		t.Errorf("connection age = %v after disconnecting, want NaN", got)
+	}
+}
@@ -0,0 +1,187 @@
+package imaptester
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+)
+
+const defaultQuotaWarningPercent = 90
+
+// quotaResource is one resource of a QUOTA response (RFC 2087, RFC 9208).
+type quotaResource struct {
+	root  string
+	name  string
+	usage uint64
+	limit uint64
+}
+
+type getQuotaRoot struct {
+	mailbox string
+}
+
+func (cmd *getQuotaRoot) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "GETQUOTAROOT",
+		Arguments: []interface{}{imap.FormatMailboxName(cmd.mailbox)},
+	}
+}
+
+// UsageTest exports the quota of the INBOX quota roots, if the server supports QUOTA, and
+// the message and unseen counts of the status folders. It returns the highest percentage
+// of any quota limit in use.
+func (t *Tester) UsageTest(ctx context.Context) (highest float64, err error) {
+	_, span := t.startSpan(ctx, "usage")
+	defer func() { t.endSpan(span, "usage", err) }()
+
+	c := t.client.Load()
+	if c == nil {
+		err := fmt.Errorf("no active connection")
+		t.handleFailure("usage", err)
+		return 0, err
+	}
+
+	start := time.Now()
+	supported, err := c.Support("QUOTA")
+	if err != nil {
+		t.handleFailure("usage", err)
+		return 0, err
+	}
+	if supported {
+		resources, err := t.quotaRoot("INBOX")
+		if err != nil {
+			t.handleFailure("usage", err)
+			return 0, fmt.Errorf("getquotaroot failed: %w", err)
+		}
+
+		quotaUsage.DeletePartialMatch(t.seriesLabels())
+		quotaLimit.DeletePartialMatch(t.seriesLabels())
+		for _, r := range resources {
+			usage, limit := float64(r.usage), float64(r.limit)
+			if r.name == "STORAGE" {
+				// STORAGE is counted in units of 1024 octets.
+				usage, limit = usage*1024, limit*1024
+			}
+			quotaUsage.WithLabelValues(t.cfg.Name, t.address, r.root, r.name).Set(usage)
+			quotaLimit.WithLabelValues(t.cfg.Name, t.address, r.root, r.name).Set(limit)
+			if r.limit > 0 && usage/limit*100 > highest {
+				highest = usage / limit * 100
+			}
+		}
+	}
+
+	folders := t.cfg.StatusFolders
+	if len(folders) == 0 {
+		folders = []string{"INBOX"}
+	}
+	for _, folder := range folders {
+		status, err := c.Status(folder, []imap.StatusItem{imap.StatusMessages, imap.StatusUnseen})
+		if err != nil {
+			t.handleFailure("usage", err)
+			return 0, fmt.Errorf("status of %s failed: %w", folder, err)
+		}
+		folderMessages.WithLabelValues(t.cfg.Name, t.address, folder).Set(float64(status.Messages))
+		folderUnseen.WithLabelValues(t.cfg.Name, t.address, folder).Set(float64(status.Unseen))
+	}
+
+	t.session.Load().Step(t.stepName("usage"), time.Since(start))
+	return highest, nil
+}
+
+// quotaRoot sends GETQUOTAROOT and collects the resources of the QUOTA responses.
+func (t *Tester) quotaRoot(mailbox string) ([]quotaResource, error) {
+	c := t.client.Load()
+	var resources []quotaResource
+	var parseErr error
+
+	handler := responses.HandlerFunc(func(resp imap.Resp) error {
+		name, fields, ok := imap.ParseNamedResp(resp)
+		if !ok {
+			return responses.ErrUnhandled
+		}
+		switch name {
+		case "QUOTAROOT":
+			return nil
+		case "QUOTA":
+			r, err := parseQuota(fields)
+			if err != nil && parseErr == nil {
+				parseErr = err
+			}
+			resources = append(resources, r...)
+			return nil
+		}
+		return responses.ErrUnhandled
+	})
+
+	status, err := c.Execute(&getQuotaRoot{mailbox: mailbox}, handler)
+	if err != nil {
+		return nil, err
+	}
+	if err := status.Err(); err != nil {
+		return nil, err
+	}
+	return resources, parseErr
+}
+
+// parseQuota parses `QUOTA root (name usage limit ...)`.
+func parseQuota(fields []interface{}) ([]quotaResource, error) {
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("malformed QUOTA response")
+	}
+	root, err := imap.ParseString(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed QUOTA root: %w", err)
+	}
+	list, ok := fields[1].([]interface{})
+	if !ok || len(list)%3 != 0 {
+		return nil, fmt.Errorf("malformed QUOTA resource list")
+	}
+
+	var resources []quotaResource
+	for i := 0; i < len(list); i += 3 {
+		name, err := imap.ParseString(list[i])
+		if err != nil {
+			return nil, fmt.Errorf("malformed QUOTA resource: %w", err)
+		}
+		usage, err := parseQuotaNumber(list[i+1])
+		if err != nil {
+			return nil, err
+		}
+		limit, err := parseQuotaNumber(list[i+2])
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, quotaResource{root, strings.ToUpper(name), usage, limit})
+	}
+	return resources, nil
+}
+
+// parseQuotaNumber accepts the 63-bit numbers of RFC 9208, which do not fit imap.ParseNumber.
+func parseQuotaNumber(f interface{}) (uint64, error) {
+	s, err := imap.ParseString(f)
+	if err != nil {
+		return 0, fmt.Errorf("malformed QUOTA number: %w", err)
+	}
+	n, err := strconv.ParseUint(s, 10, 63)
+	if err != nil {
+		return 0, fmt.Errorf("malformed QUOTA number: %w", err)
+	}
+	return n, nil
+}
+
+// warnQuota logs a warning when the quota is nearly exhausted, since a full mailbox makes
+// the append test fail with server-specific errors. A threshold of 0 disables the warning.
+func (t *Tester) warnQuota(percent float64) {
+	threshold := float64(defaultQuotaWarningPercent)
+	if t.cfg.QuotaWarningPercent != nil {
+		threshold = *t.cfg.QuotaWarningPercent
+	}
+	if threshold > 0 && percent >= threshold {
+		t.log().Warn("Quota nearly exhausted, the append test may fail", "operation", "usage", "percent", percent)
+	}
+}
@@ -0,0 +1,34 @@
+package imaptester
+
+import (
+	"context"
+
+	"github.com/dniminenn/mailmetrix/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/dniminenn/mailmetrix/imaptester")
+
+// startSpan starts the span of an operation, as a child of the session span in ctx.
+func (t *Tester) startSpan(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attribute.String("mailmetrix.server", t.cfg.Name),
+		semconv.ServerAddress(t.cfg.Host),
+		semconv.ServerPort(t.cfg.Port),
+	)
+	if t.address != "" {
+		attrs = append(attrs, semconv.NetworkPeerAddress(t.address))
+	}
+	return tracer.Start(ctx, "imap."+operation, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends the span of an operation, marking it failed with the reason of err.
+func (t *Tester) endSpan(span trace.Span, operation string, err error) {
+	if err != nil {
+		tracing.Fail(span, t.classify(operation, err), err)
+	}
+	span.End()
+}
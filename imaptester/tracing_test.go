@@ -0,0 +1,149 @@
+package imaptester
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/errclass"
+	"github.com/dniminenn/mailmetrix/results"
+	"github.com/dniminenn/mailmetrix/tracing"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+var (
+	recorderOnce sync.Once
+	recorder     *tracetest.SpanRecorder
+)
+
+// installRecorder routes the spans of the package tracer to an in-memory recorder. The
+// global provider only delegates once, so every test shares the recorder.
+func installRecorder() *tracetest.SpanRecorder {
+	recorderOnce.Do(func() {
+		recorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(tracing.NewProvider(recorder))
+	})
+	return recorder
+}
+
+// newFakeServer serves the go-imap memory backend, with user "username" and password
+// "password", over plaintext TCP on a local port.
+func newFakeServer(t *testing.T) int {
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.ErrorLog = log.New(io.Discard, "", 0)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// sessionSpans runs a session and returns the spans of its trace.
+func sessionSpans(t *testing.T, cfg config.ServerConfig) ([]sdktrace.ReadOnlySpan, error) {
+	rec := installRecorder()
+	ctx, _ := results.NewContext(context.Background())
+	err := NewTester(cfg).RunSession(ctx)
+
+	var session sdktrace.ReadOnlySpan
+	for _, span := range rec.Ended() {
+		if span.Name() == "imap.session" && attributeValue(span, "mailmetrix.server") == cfg.Name {
+			session = span
+		}
+	}
+	if session == nil {
+		t.Fatal("no session span recorded")
+	}
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range rec.Ended() {
+		if span.SpanContext().TraceID() == session.SpanContext().TraceID() {
+			spans = append(spans, span)
+		}
+	}
+	return spans, err
+}
+
+func attributeValue(span sdktrace.ReadOnlySpan, key attribute.Key) string {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestSessionSpans(t *testing.T) {
+	port := newFakeServer(t)
+	spans, err := sessionSpans(t, config.ServerConfig{
+		Name: "spans", Host: "127.0.0.1", Port: port, Username: "username", Password: "password",
+	})
+	if err != nil {
+		t.Fatalf("RunSession() = %v", err)
+	}
+
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	for _, want := range []string{
+		"imap.session", "imap.dial", "imap.tls", "imap.banner", "imap.login",
+		"imap.select", "imap.fetch", "imap.append", "imap.expunge",
+	} {
+		if !slices.Contains(names, want) {
+			t.Errorf("span %s not recorded, got %v", want, names)
+		}
+	}
+
+	for _, span := range spans {
+		switch span.Name() {
+		case "imap.tls":
+			// The fake server does not speak TLS, so the tester falls back to plaintext.
+			if got := attributeValue(span, semconv.ErrorTypeKey); got != errclass.TLS {
+				t.Errorf("tls span error.type = %q, want %q", got, errclass.TLS)
+			}
+		case "imap.session", "imap.login", "imap.append":
+			if got := attributeValue(span, semconv.ErrorTypeKey); got != "" {
+				t.Errorf("%s span error.type = %q, want none", span.Name(), got)
+			}
+		}
+	}
+}
+
+func TestFailedLoginSpan(t *testing.T) {
+	port := newFakeServer(t)
+	spans, err := sessionSpans(t, config.ServerConfig{
+		Name: "failed-login", Host: "127.0.0.1", Port: port, Username: "username", Password: "wrong",
+	})
+	if err == nil {
+		t.Fatal("RunSession() succeeded with a wrong password")
+	}
+
+	found := false
+	for _, span := range spans {
+		switch span.Name() {
+		case "imap.login", "imap.session":
+			found = found || span.Name() == "imap.login"
+			if got := attributeValue(span, semconv.ErrorTypeKey); got != errclass.Auth {
+				t.Errorf("%s span error.type = %q, want %q", span.Name(), got, errclass.Auth)
+			}
+		case "imap.append", "imap.fetch":
+			t.Errorf("%s span recorded after the failed login", span.Name())
+		}
+	}
+	if !found {
+		t.Error("no login span recorded")
+	}
+}
@@ -0,0 +1,41 @@
+package imaptester
+
+import (
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// debugWriter forwards one direction of the go-imap debug output to the transcript of the
+// current session, so a persistent connection records into the transcript of every run.
+type debugWriter struct {
+	t      *Tester
+	prefix string
+}
+
+func (w debugWriter) Write(p []byte) (int, error) {
+	w.t.transcript.Load().Append(w.prefix, p)
+	return len(p), nil
+}
+
+// transcriptPrefix returns the line prefix of the client ("C") or server ("S") side,
+// with the pinned address.
+func (t *Tester) transcriptPrefix(side string) string {
+	if t.address == "" {
+		return side + ": "
+	}
+	return "[" + t.address + "] " + side + ": "
+}
+
+// enableTranscript attaches the debug writers to a new connection when the session records
+// a transcript. The greeting was read before the writers could be attached and is added first.
+func (t *Tester) enableTranscript(c *client.Client, greeting string) {
+	tr := t.transcript.Load()
+	if tr == nil {
+		return
+	}
+	tr.Append(t.transcriptPrefix("S"), []byte(greeting+"\r\n"))
+	c.SetDebug(imap.NewDebugWriter(
+		debugWriter{t: t, prefix: t.transcriptPrefix("C")},
+		debugWriter{t: t, prefix: t.transcriptPrefix("S")},
+	))
+}
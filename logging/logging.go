@@ -0,0 +1,137 @@
+// Package logging sets up structured logging with log/slog. Packages get their logger from
+// New, whose level can be set apart from the others; output of the standard log package
+// goes through the same handler at the root level.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dniminenn/mailmetrix/config"
+)
+
+type logger struct {
+	name  string
+	level slog.LevelVar
+	// handler is the configured handler with the logger attribute added.
+	handler atomic.Pointer[slog.Handler]
+}
+
+var (
+	mu      sync.Mutex
+	loggers = make(map[string]*logger)
+	// base is the configured handler; records are filtered before they reach it.
+	base   slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	level  slog.Level
+	levels map[string]slog.Level
+	root   = register("")
+)
+
+func register(name string) *logger {
+	mu.Lock()
+	defer mu.Unlock()
+	if l, ok := loggers[name]; ok {
+		return l
+	}
+	l := &logger{name: name}
+	l.configure()
+	loggers[name] = l
+	return l
+}
+
+// configure applies the configured handler and level. The caller holds mu.
+func (l *logger) configure() {
+	l.setHandler(base)
+	if packageLevel, ok := levels[l.name]; ok {
+		l.level.Set(packageLevel)
+	} else {
+		l.level.Set(level)
+	}
+}
+
+func (l *logger) setHandler(h slog.Handler) {
+	if l.name != "" {
+		h = h.WithAttrs([]slog.Attr{slog.String("logger", l.name)})
+	}
+	l.handler.Store(&h)
+}
+
+// New returns the logger of a package. It logs at info level until Setup applies the
+// configured level.
+func New(name string) *slog.Logger {
+	return slog.New(&handler{logger: register(name)})
+}
+
+// Setup applies the configured format and levels and sends the output of the standard
+// log package through the root logger.
+func Setup(cfg config.LoggingConfig) error {
+	var rootLevel slog.Level
+	if err := rootLevel.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+	packageLevels := make(map[string]slog.Level, len(cfg.Levels))
+	for name, value := range cfg.Levels {
+		var packageLevel slog.Level
+		if err := packageLevel.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("invalid log level for %s: %w", name, err)
+		}
+		packageLevels[name] = packageLevel
+	}
+
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var h slog.Handler
+	switch cfg.Format {
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, options)
+	case "text":
+		h = slog.NewTextHandler(os.Stderr, options)
+	default:
+		return fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	mu.Lock()
+	base, level, levels = h, rootLevel, packageLevels
+	for _, l := range loggers {
+		l.configure()
+	}
+	mu.Unlock()
+
+	slog.SetDefault(slog.New(&handler{logger: root}))
+	return nil
+}
+
+// handler filters records by the level of its logger and hands them to the configured
+// handler, so loggers created before Setup follow the configuration.
+type handler struct {
+	logger *logger
+	// derived is set by WithAttrs and WithGroup, which bind to the handler configured at
+	// the time.
+	derived slog.Handler
+}
+
+func (h *handler) current() slog.Handler {
+	if h.derived != nil {
+		return h.derived
+	}
+	return *h.logger.handler.Load()
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.logger.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	return h.current().Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{logger: h.logger, derived: h.current().WithAttrs(attrs)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{logger: h.logger, derived: h.current().WithGroup(name)}
+}
@@ -0,0 +1,56 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dniminenn/mailmetrix/config"
+)
+
+// httpSender posts requests to a receiver, with the configured credentials and headers.
+type httpSender struct {
+	cfg    config.PushTargetConfig
+	client *http.Client
+}
+
+func newHTTPSender(cfg config.PushTargetConfig) *httpSender {
+	return &httpSender{cfg: cfg, client: &http.Client{}}
+}
+
+// post sends body and classifies the response: 2xx is success, other 4xx apart from 429
+// are permanent rejections, and everything else is retried.
+func (s *httpSender) post(ctx context.Context, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to create request: %w", err)}
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return err
+}
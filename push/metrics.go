@@ -0,0 +1,51 @@
+package push
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	pushRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "push_requests_total",
+			Help:      "Total number of push requests by receiver and outcome (sent, failed, rejected or dropped)",
+			Namespace: "mailmetrix",
+		},
+		[]string{"receiver", "status"},
+	)
+	pushQueueRequests = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "push_queue_requests",
+			Help:      "Number of requests waiting to be sent to the receiver",
+			Namespace: "mailmetrix",
+		},
+		[]string{"receiver"},
+	)
+	pushQueueBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "push_queue_bytes",
+			Help:      "Size of the requests waiting to be sent to the receiver",
+			Namespace: "mailmetrix",
+		},
+		[]string{"receiver"},
+	)
+)
+
+func init() {
+	metrics := []prometheus.Collector{
+		pushRequests,
+		pushQueueRequests,
+		pushQueueBytes,
+	}
+
+	for _, metric := range metrics {
+		if err := prometheus.Register(metric); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				prometheus.Unregister(are.ExistingCollector)
+				prometheus.MustRegister(metric)
+			} else {
+				logger.Error("Error registering metric", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package push
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	dto "github.com/prometheus/client_model/go"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const scopeName = "github.com/dniminenn/mailmetrix/push"
+
+// otlp sends the metrics as OTLP ExportMetricsServiceRequests, over HTTP with protobuf
+// encoding or over gRPC. Counters and histograms are cumulative since process start.
+type otlp struct {
+	cfg      config.PushTargetConfig
+	resource *resourcepb.Resource
+	start    uint64
+
+	http *httpSender
+	grpc colmetricspb.MetricsServiceClient
+}
+
+func newOTLP(cfg config.PushTargetConfig, externalLabels map[string]string) (*otlp, error) {
+	attributes := map[string]string{"service.name": "mailmetrix"}
+	for k, v := range externalLabels {
+		attributes[k] = v
+	}
+	o := &otlp{
+		cfg:      cfg,
+		resource: &resourcepb.Resource{Attributes: keyValues(attributes)},
+		start:    uint64(time.Now().UnixNano()),
+	}
+
+	if cfg.Protocol != "grpc" {
+		o.http = newHTTPSender(cfg)
+		return o, nil
+	}
+	creds := credentials.NewTLS(&tls.Config{})
+	if cfg.Insecure {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.NewClient(cfg.URL, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("push otlp: failed to create gRPC client: %w", err)
+	}
+	o.grpc = colmetricspb.NewMetricsServiceClient(conn)
+	return o, nil
+}
+
+func (o *otlp) encode(families []*dto.MetricFamily, now time.Time) ([][]byte, error) {
+	var requests [][]byte
+	var batch []*metricspb.Metric
+	count := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		request, err := proto.Marshal(&colmetricspb.ExportMetricsServiceRequest{
+			ResourceMetrics: []*metricspb.ResourceMetrics{{
+				Resource: o.resource,
+				ScopeMetrics: []*metricspb.ScopeMetrics{{
+					Scope:   &commonpb.InstrumentationScope{Name: scopeName},
+					Metrics: batch,
+				}},
+			}},
+		})
+		if err != nil {
+			return err
+		}
+		requests = append(requests, request)
+		batch, count = nil, 0
+		return nil
+	}
+
+	for _, family := range families {
+		metrics := family.GetMetric()
+		for len(metrics) > 0 {
+			n := min(len(metrics), o.cfg.BatchSize-count)
+			batch = append(batch, o.convert(family, metrics[:n], now))
+			metrics = metrics[n:]
+			count += n
+			if count >= o.cfg.BatchSize {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// convert maps the series of a Prometheus family to an OTLP metric.
+func (o *otlp) convert(family *dto.MetricFamily, metrics []*dto.Metric, now time.Time) *metricspb.Metric {
+	out := &metricspb.Metric{Name: family.GetName(), Description: family.GetHelp()}
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		sum := &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+		}
+		for _, m := range metrics {
+			sum.DataPoints = append(sum.DataPoints, o.numberPoint(m, m.GetCounter().GetValue(), now))
+		}
+		out.Data = &metricspb.Metric_Sum{Sum: sum}
+
+	case dto.MetricType_HISTOGRAM:
+		histogram := &metricspb.Histogram{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+		}
+		for _, m := range metrics {
+			h := m.GetHistogram()
+			point := &metricspb.HistogramDataPoint{
+				Attributes:        labelValues(m),
+				StartTimeUnixNano: o.start,
+				TimeUnixNano:      timestamp(m, now),
+				Count:             h.GetSampleCount(),
+				Sum:               proto.Float64(h.GetSampleSum()),
+			}
+			// Prometheus buckets are cumulative, OTLP bucket counts are per bucket.
+			var previous uint64
+			for _, b := range h.GetBucket() {
+				if math.IsInf(b.GetUpperBound(), 1) {
+					continue
+				}
+				point.ExplicitBounds = append(point.ExplicitBounds, b.GetUpperBound())
+				point.BucketCounts = append(point.BucketCounts, b.GetCumulativeCount()-previous)
+				previous = b.GetCumulativeCount()
+			}
+			point.BucketCounts = append(point.BucketCounts, h.GetSampleCount()-previous)
+			histogram.DataPoints = append(histogram.DataPoints, point)
+		}
+		out.Data = &metricspb.Metric_Histogram{Histogram: histogram}
+
+	case dto.MetricType_SUMMARY:
+		summary := &metricspb.Summary{}
+		for _, m := range metrics {
+			s := m.GetSummary()
+			point := &metricspb.SummaryDataPoint{
+				Attributes:        labelValues(m),
+				StartTimeUnixNano: o.start,
+				TimeUnixNano:      timestamp(m, now),
+				Count:             s.GetSampleCount(),
+				Sum:               s.GetSampleSum(),
+			}
+			for _, q := range s.GetQuantile() {
+				point.QuantileValues = append(point.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+					Quantile: q.GetQuantile(),
+					Value:    q.GetValue(),
+				})
+			}
+			summary.DataPoints = append(summary.DataPoints, point)
+		}
+		out.Data = &metricspb.Metric_Summary{Summary: summary}
+
+	default:
+		gauge := &metricspb.Gauge{}
+		for _, m := range metrics {
+			value := m.GetGauge().GetValue()
+			if family.GetType() == dto.MetricType_UNTYPED {
+				value = m.GetUntyped().GetValue()
+			}
+			point := o.numberPoint(m, value, now)
+			point.StartTimeUnixNano = 0
+			gauge.DataPoints = append(gauge.DataPoints, point)
+		}
+		out.Data = &metricspb.Metric_Gauge{Gauge: gauge}
+	}
+	return out
+}
+
+func (o *otlp) numberPoint(m *dto.Metric, value float64, now time.Time) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:        labelValues(m),
+		StartTimeUnixNano: o.start,
+		TimeUnixNano:      timestamp(m, now),
+		Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+	}
+}
+
+func (o *otlp) send(ctx context.Context, request []byte) error {
+	if o.grpc == nil {
+		return o.http.post(ctx, request, map[string]string{"Content-Type": "application/x-protobuf"})
+	}
+
+	var req colmetricspb.ExportMetricsServiceRequest
+	if err := proto.Unmarshal(request, &req); err != nil {
+		return &permanentError{fmt.Errorf("corrupt buffered request: %w", err)}
+	}
+	md := metadata.New(o.cfg.Headers)
+	if o.cfg.Username != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(o.cfg.Username + ":" + o.cfg.Password))
+		md.Set("authorization", "Basic "+auth)
+	}
+	_, err := o.grpc.Export(metadata.NewOutgoingContext(ctx, md), &req)
+	if err == nil {
+		return nil
+	}
+	// The retryable codes of the OTLP specification; anything else will not succeed on retry.
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange,
+		codes.Unavailable, codes.DataLoss, codes.ResourceExhausted:
+		return err
+	}
+	return &permanentError{err}
+}
+
+func timestamp(m *dto.Metric, now time.Time) uint64 {
+	if m.TimestampMs != nil {
+		return uint64(m.GetTimestampMs()) * uint64(time.Millisecond)
+	}
+	return uint64(now.UnixNano())
+}
+
+func labelValues(m *dto.Metric) []*commonpb.KeyValue {
+	kvs := make([]*commonpb.KeyValue, 0, len(m.GetLabel()))
+	for _, l := range m.GetLabel() {
+		kvs = append(kvs, keyValue(l.GetName(), l.GetValue()))
+	}
+	return kvs
+}
+
+func keyValues(attributes map[string]string) []*commonpb.KeyValue {
+	kvs := make([]*commonpb.KeyValue, 0, len(attributes))
+	for _, k := range slices.Sorted(maps.Keys(attributes)) {
+		kvs = append(kvs, keyValue(k, attributes[k]))
+	}
+	return kvs
+}
+
+func keyValue(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
@@ -0,0 +1,165 @@
+// Package push sends the registered metrics to receivers that cannot scrape this instance,
+// over Prometheus remote-write or OTLP. Every interval the metrics are gathered, encoded
+// into requests of at most the batch size and queued; a sender per receiver delivers the
+// queue in order, retrying with exponential backoff while the receiver is unavailable.
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var logger = logging.New("push")
+
+const (
+	minBackoff  = time.Second
+	maxBackoff  = 5 * time.Minute
+	sendTimeout = 30 * time.Second
+)
+
+// permanentError is a rejection that retrying will not fix, such as a malformed request.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// receiver is one push destination.
+type receiver interface {
+	// encode turns the gathered families into requests of at most batchSize series each.
+	encode(families []*dto.MetricFamily, now time.Time) ([][]byte, error)
+	// send delivers one encoded request. Errors wrapping permanentError are not retried.
+	send(ctx context.Context, request []byte) error
+}
+
+type pusher struct {
+	name     string
+	receiver receiver
+	queue    *queue
+}
+
+// Start begins pushing the metrics of gatherer to every configured receiver until ctx is done.
+func Start(ctx context.Context, cfg config.PushConfig, gatherer prometheus.Gatherer) error {
+	var pushers []*pusher
+	if cfg.RemoteWrite.URL != "" {
+		p, err := newPusher("remote_write", newRemoteWrite(cfg.RemoteWrite, cfg.ExternalLabels), cfg.RemoteWrite)
+		if err != nil {
+			return err
+		}
+		pushers = append(pushers, p)
+	}
+	if cfg.OTLP.URL != "" {
+		r, err := newOTLP(cfg.OTLP, cfg.ExternalLabels)
+		if err != nil {
+			return err
+		}
+		p, err := newPusher("otlp", r, cfg.OTLP)
+		if err != nil {
+			return err
+		}
+		pushers = append(pushers, p)
+	}
+
+	for _, p := range pushers {
+		go p.run(ctx)
+	}
+	go gatherLoop(ctx, time.Duration(cfg.IntervalSeconds)*time.Second, gatherer, pushers)
+	return nil
+}
+
+func newPusher(name string, r receiver, cfg config.PushTargetConfig) (*pusher, error) {
+	q, err := newQueue(name, cfg.BufferDir, int64(cfg.MaxBufferMB)<<20)
+	if err != nil {
+		return nil, fmt.Errorf("push %s: %w", name, err)
+	}
+	return &pusher{name: name, receiver: r, queue: q}, nil
+}
+
+func gatherLoop(ctx context.Context, interval time.Duration, gatherer prometheus.Gatherer, pushers []*pusher) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			families, err := gatherer.Gather()
+			if err != nil {
+				// Gather returns what it could collect along with the error.
+				logger.Error("Gathering metrics failed", "error", err)
+			}
+			for _, p := range pushers {
+				p.enqueue(families, now)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *pusher) enqueue(families []*dto.MetricFamily, now time.Time) {
+	requests, err := p.receiver.encode(families, now)
+	if err != nil {
+		logger.Error("Encoding request failed", "receiver", p.name, "error", err)
+		return
+	}
+	for _, request := range requests {
+		if err := p.queue.push(request); err != nil {
+			logger.Error("Queueing request failed", "receiver", p.name, "error", err)
+		}
+	}
+}
+
+// run sends the queued requests in order. A request is retried until it is accepted or
+// permanently rejected, so later samples never overtake earlier ones.
+func (p *pusher) run(ctx context.Context) {
+	backoff := minBackoff
+	for {
+		seq, request, ok := p.queue.peek()
+		if !ok {
+			select {
+			case <-p.queue.ready:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err := p.receiver.send(sendCtx, request)
+		cancel()
+
+		var permanent *permanentError
+		switch {
+		case err == nil:
+			pushRequests.WithLabelValues(p.name, "sent").Inc()
+			p.queue.pop(seq)
+			backoff = minBackoff
+		case errors.As(err, &permanent):
+			logger.Error("Request rejected, dropping it", "receiver", p.name, "error", err)
+			pushRequests.WithLabelValues(p.name, "rejected").Inc()
+			p.queue.pop(seq)
+		default:
+			logger.Warn("Sending failed, retrying", "receiver", p.name, "backoff", backoff, "error", err)
+			pushRequests.WithLabelValues(p.name, "failed").Inc()
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff = min(backoff*2, maxBackoff)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package push
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const batchSuffix = ".batch"
+
+// queue holds the encoded requests not yet accepted by a receiver, oldest first. With a
+// directory every request is a file in it, so the backlog survives a restart. When the
+// queue grows beyond maxBytes the oldest requests are dropped, while the one being sent
+// stays until the sender pops it.
+type queue struct {
+	name     string
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries []queueEntry
+	size    int64
+	// seq numbers the entries in queue order.
+	seq   uint64
+	ready chan struct{}
+}
+
+type queueEntry struct {
+	seq uint64
+	// file is the path of the request on disk, or "" for a request held in data.
+	file string
+	data []byte
+	size int64
+}
+
+// newQueue opens the queue, picking up the requests left in dir by a previous run.
+func newQueue(name, dir string, maxBytes int64) (*queue, error) {
+	q := &queue{name: name, dir: dir, maxBytes: maxBytes, ready: make(chan struct{}, 1)}
+	if dir == "" {
+		return q, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create buffer directory: %w", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+batchSuffix))
+	if err != nil {
+		return nil, err
+	}
+	// File names start with a fixed-width timestamp, so they sort in queue order.
+	sort.Strings(files)
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		q.seq++
+		q.entries = append(q.entries, queueEntry{seq: q.seq, file: file, size: info.Size()})
+		q.size += info.Size()
+	}
+	if len(q.entries) > 0 {
+		logger.Info("Resuming buffered requests", "receiver", name, "requests", len(q.entries))
+		q.signal()
+	}
+	q.updateMetrics()
+	return q, nil
+}
+
+// push appends a request to the queue.
+func (q *queue) push(data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	entry := queueEntry{seq: q.seq, data: data, size: int64(len(data))}
+	if q.dir != "" {
+		name := fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), q.seq%1000000, batchSuffix)
+		file := filepath.Join(q.dir, name)
+		tmp := file + ".tmp"
+		if err := os.WriteFile(tmp, data, 0o600); err != nil {
+			return fmt.Errorf("failed to buffer request: %w", err)
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to buffer request: %w", err)
+		}
+		entry = queueEntry{seq: q.seq, file: file, size: int64(len(data))}
+	}
+	q.entries = append(q.entries, entry)
+	q.size += entry.size
+
+	// The head may be in flight, so the oldest request after it is dropped instead.
+	for q.size > q.maxBytes && len(q.entries) > 2 {
+		logger.Warn("Buffer is full, dropping the oldest request", "receiver", q.name)
+		pushRequests.WithLabelValues(q.name, "dropped").Inc()
+		q.remove(1)
+	}
+	q.updateMetrics()
+	q.signal()
+	return nil
+}
+
+// peek returns the oldest request with its sequence number, or false if the queue is empty.
+func (q *queue) peek() (uint64, []byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.entries) > 0 {
+		entry := q.entries[0]
+		if entry.file == "" {
+			return entry.seq, entry.data, true
+		}
+		data, err := os.ReadFile(entry.file)
+		if err == nil {
+			return entry.seq, data, true
+		}
+		logger.Error("Skipping unreadable request", "receiver", q.name, "file", entry.file, "error", err)
+		q.remove(0)
+		q.updateMetrics()
+	}
+	return 0, nil, false
+}
+
+// pop removes the request with the given sequence number after it was sent or rejected,
+// if it is still the oldest.
+func (q *queue) pop(seq uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.entries) > 0 && q.entries[0].seq == seq {
+		q.remove(0)
+		q.updateMetrics()
+	}
+}
+
+func (q *queue) remove(i int) {
+	entry := q.entries[i]
+	if entry.file != "" {
+		if err := os.Remove(entry.file); err != nil && !os.IsNotExist(err) {
+			logger.Error("Failed to remove request", "receiver", q.name, "file", entry.file, "error", err)
+		}
+	}
+	q.entries = append(q.entries[:i], q.entries[i+1:]...)
+	q.size -= entry.size
+}
+
+func (q *queue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue) updateMetrics() {
+	pushQueueRequests.WithLabelValues(q.name).Set(float64(len(q.entries)))
+	pushQueueBytes.WithLabelValues(q.name).Set(float64(q.size))
+}
@@ -0,0 +1,156 @@
+package push
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/klauspost/compress/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// remoteWrite sends the metrics as snappy-compressed Prometheus remote-write 1.0 requests.
+// The WriteRequest protobuf is small enough to encode by hand rather than depend on prompb.
+type remoteWrite struct {
+	cfg            config.PushTargetConfig
+	externalLabels map[string]string
+	client         *httpSender
+}
+
+func newRemoteWrite(cfg config.PushTargetConfig, externalLabels map[string]string) *remoteWrite {
+	return &remoteWrite{cfg: cfg, externalLabels: externalLabels, client: newHTTPSender(cfg)}
+}
+
+type label struct {
+	name, value string
+}
+
+type sample struct {
+	labels    []label
+	value     float64
+	timestamp int64
+}
+
+func (r *remoteWrite) encode(families []*dto.MetricFamily, now time.Time) ([][]byte, error) {
+	samples := flatten(families, r.externalLabels, now)
+
+	var requests [][]byte
+	for start := 0; start < len(samples); start += r.cfg.BatchSize {
+		end := min(start+r.cfg.BatchSize, len(samples))
+		var request []byte
+		for _, s := range samples[start:end] {
+			request = protowire.AppendTag(request, 1, protowire.BytesType)
+			request = protowire.AppendBytes(request, encodeTimeSeries(s))
+		}
+		requests = append(requests, snappy.Encode(nil, request))
+	}
+	return requests, nil
+}
+
+func (r *remoteWrite) send(ctx context.Context, request []byte) error {
+	return r.client.post(ctx, request, map[string]string{
+		"Content-Type":                      "application/x-protobuf",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	})
+}
+
+// encodeTimeSeries encodes a TimeSeries message with a single sample.
+func encodeTimeSeries(s sample) []byte {
+	var ts []byte
+	for _, l := range s.labels {
+		var lb []byte
+		lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.name)
+		lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.value)
+		ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, lb)
+	}
+
+	var sb []byte
+	sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+	sb = protowire.AppendFixed64(sb, math.Float64bits(s.value))
+	sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+	sb = protowire.AppendVarint(sb, uint64(s.timestamp))
+	ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+	return protowire.AppendBytes(ts, sb)
+}
+
+// flatten turns the metric families into one sample per series the way Prometheus scrapes
+// them: histograms and summaries become their _bucket, _sum, _count and quantile series.
+func flatten(families []*dto.MetricFamily, externalLabels map[string]string, now time.Time) []sample {
+	var samples []sample
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.GetMetric() {
+			timestamp := now.UnixMilli()
+			if m.TimestampMs != nil {
+				timestamp = m.GetTimestampMs()
+			}
+			add := func(name string, value float64, extra ...label) {
+				labels := make([]label, 0, len(m.GetLabel())+len(externalLabels)+len(extra)+1)
+				labels = append(labels, label{"__name__", name})
+				for k, v := range externalLabels {
+					labels = append(labels, label{k, v})
+				}
+				for _, l := range m.GetLabel() {
+					labels = append(labels, label{l.GetName(), l.GetValue()})
+				}
+				labels = append(labels, extra...)
+				samples = append(samples, sample{labels: sortLabels(labels), value: value, timestamp: timestamp})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, q.GetValue(), label{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", s.GetSampleSum())
+				add(name+"_count", float64(s.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), 1) {
+						continue
+					}
+					add(name+"_bucket", float64(b.GetCumulativeCount()), label{"le", formatFloat(b.GetUpperBound())})
+				}
+				add(name+"_bucket", float64(h.GetSampleCount()), label{"le", "+Inf"})
+				add(name+"_sum", h.GetSampleSum())
+				add(name+"_count", float64(h.GetSampleCount()))
+			}
+		}
+	}
+	return samples
+}
+
+// sortLabels sorts the labels by name as remote-write requires; a series label overrides
+// an external label of the same name.
+func sortLabels(labels []label) []label {
+	sort.SliceStable(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	out := labels[:0]
+	for _, l := range labels {
+		if len(out) > 0 && out[len(out)-1].name == l.name {
+			out[len(out)-1] = l
+			continue
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,63 @@
+package results
+
+import (
+	"github.com/dniminenn/mailmetrix/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var logger = logging.New("results")
+
+var (
+	probeSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "probe_success",
+			Help:      "Whether the last probe session succeeded (1) or failed (0)",
+			Namespace: "mailmetrix",
+		},
+		[]string{"kind", "server"},
+	)
+	probeDuration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "probe_duration_seconds",
+			Help:      "Duration of the last probe session",
+			Namespace: "mailmetrix",
+		},
+		[]string{"kind", "server"},
+	)
+	probeAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "probe_attempts_total",
+			Help:      "Total number of probe sessions run",
+			Namespace: "mailmetrix",
+		},
+		[]string{"kind", "server"},
+	)
+	probeSuccesses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "probe_successes_total",
+			Help:      "Total number of probe sessions that succeeded",
+			Namespace: "mailmetrix",
+		},
+		[]string{"kind", "server"},
+	)
+)
+
+func init() {
+	metrics := []prometheus.Collector{
+		probeSuccess,
+		probeDuration,
+		probeAttempts,
+		probeSuccesses,
+	}
+
+	for _, metric := range metrics {
+		if err := prometheus.Register(metric); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				prometheus.Unregister(are.ExistingCollector)
+				prometheus.MustRegister(metric)
+			} else {
+				logger.Error("Error registering metric", "error", err)
+			}
+		}
+	}
+}
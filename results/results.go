@@ -0,0 +1,121 @@
+// Package results collects the outcome of every probe session run by the scheduler,
+// exports the availability metrics and passes each result on to the registered observers.
+package results
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/errclass"
+)
+
+// Result is the outcome of one RunSession call.
+type Result struct {
+	// Kind is the tester kind in lower case, such as "imap" or "webmail".
+	Kind     string
+	Server   string
+	Time     time.Time
+	Duration time.Duration
+	Err      error
+	// Reason is the failure reason of a failed session, set by Record.
+	Reason string
+	// Session holds the details the tester recorded, if any.
+	Session *Session
+}
+
+// Success reports whether the session completed without error.
+func (r Result) Success() bool {
+	return r.Err == nil
+}
+
+// Entry is the JSON form of a result.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Server   string    `json:"server"`
+	Success  bool      `json:"success"`
+	Duration float64   `json:"duration_seconds"`
+	Error    string    `json:"error,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	TLS      string    `json:"tls,omitempty"`
+	// CertExpiry is the earliest expiry of the server certificates, if TLS was used.
+	CertExpiry *time.Time `json:"cert_expiry,omitempty"`
+	Steps      []Step     `json:"steps,omitempty"`
+	Snippets   []string   `json:"snippets,omitempty"`
+}
+
+// Entry returns the JSON form of the result.
+func (r Result) Entry() Entry {
+	e := Entry{
+		Time:     r.Time,
+		Kind:     r.Kind,
+		Server:   r.Server,
+		Success:  r.Success(),
+		Duration: r.Duration.Seconds(),
+		Reason:   r.Reason,
+	}
+	if r.Err != nil {
+		e.Error = r.Err.Error()
+	}
+	if s := r.Session; s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		e.TLS = s.tls
+		if !s.certExpiry.IsZero() {
+			expiry := s.certExpiry
+			e.CertExpiry = &expiry
+		}
+		e.Steps = append([]Step(nil), s.steps...)
+		e.Snippets = append([]string(nil), s.snippets...)
+	}
+	return e
+}
+
+// Observer is notified of every recorded result.
+type Observer interface {
+	Observe(Result)
+}
+
+var (
+	mu        sync.RWMutex
+	observers []Observer
+)
+
+// Subscribe registers an observer for all results recorded from now on.
+func Subscribe(o Observer) {
+	mu.Lock()
+	defer mu.Unlock()
+	observers = append(observers, o)
+}
+
+// Record exports the result as metrics and hands it to the observers.
+func Record(r Result) {
+	r.Kind = strings.ToLower(r.Kind)
+	if r.Err != nil && r.Reason == "" {
+		r.Reason = r.Session.Reason()
+		if r.Reason == "" {
+			r.Reason = errclass.Classify(r.Err)
+		}
+	}
+
+	probeSuccess.WithLabelValues(r.Kind, r.Server).Set(boolToFloat(r.Success()))
+	probeDuration.WithLabelValues(r.Kind, r.Server).Set(r.Duration.Seconds())
+	probeAttempts.WithLabelValues(r.Kind, r.Server).Inc()
+	if r.Success() {
+		probeSuccesses.WithLabelValues(r.Kind, r.Server).Inc()
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, o := range observers {
+		o.Observe(r)
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
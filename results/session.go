@@ -0,0 +1,114 @@
+package results
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+)
+
+const (
+	maxSnippets      = 10
+	maxSnippetLength = 256
+)
+
+// Step is the outcome of one operation within a session.
+type Step struct {
+	Name     string  `json:"name"`
+	Duration float64 `json:"duration_seconds,omitempty"`
+	Error    string  `json:"error,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+}
+
+// Session collects the details of a running session for the result history. Testers find
+// it in the context passed to RunSession; all methods are no-ops on a nil Session.
+type Session struct {
+	mu       sync.Mutex
+	steps    []Step
+	tls      string
+	snippets []string
+	// certExpiry is the earliest expiry of the server certificates seen in the session.
+	certExpiry time.Time
+}
+
+type sessionKey struct{}
+
+// NewContext returns a context carrying a new Session.
+func NewContext(ctx context.Context) (context.Context, *Session) {
+	s := &Session{}
+	return context.WithValue(ctx, sessionKey{}, s), s
+}
+
+// FromContext returns the Session of the context, or nil.
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+	return s
+}
+
+// Step records a successful operation.
+func (s *Session) Step(name string, d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps = append(s.steps, Step{Name: name, Duration: d.Seconds()})
+}
+
+// Fail records a failed operation with its failure reason.
+func (s *Session) Fail(name, reason string, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps = append(s.steps, Step{Name: name, Error: err.Error(), Reason: reason})
+}
+
+// SetTLS records the negotiated TLS version and cipher suite, and the expiry of the
+// server certificate.
+func (s *Session) SetTLS(state tls.ConnectionState) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tls = tls.VersionName(state.Version) + " " + tls.CipherSuiteName(state.CipherSuite)
+	if len(state.PeerCertificates) > 0 {
+		expiry := state.PeerCertificates[0].NotAfter
+		if s.certExpiry.IsZero() || expiry.Before(s.certExpiry) {
+			s.certExpiry = expiry
+		}
+	}
+}
+
+// Snippet keeps a truncated server response, such as a greeting or an error body.
+func (s *Session) Snippet(text string) {
+	if s == nil || text == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.snippets) >= maxSnippets {
+		return
+	}
+	if len(text) > maxSnippetLength {
+		text = text[:maxSnippetLength] + "..."
+	}
+	s.snippets = append(s.snippets, text)
+}
+
+// Reason returns the reason of the first failed step, or "" if none failed.
+func (s *Session) Reason() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, step := range s.steps {
+		if step.Reason != "" {
+			return step.Reason
+		}
+	}
+	return ""
+}
@@ -0,0 +1,147 @@
+package sievetester
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// conn is a minimal RFC 5804 ManageSieve client connection.
+type conn struct {
+	raw net.Conn
+	r   *bufio.Reader
+	w   *bufio.Writer
+}
+
+func newConn(raw net.Conn) *conn {
+	return &conn{raw: raw, r: bufio.NewReader(raw), w: bufio.NewWriter(raw)}
+}
+
+// startTLS upgrades the connection after a successful STARTTLS command.
+func (c *conn) startTLS(config *tls.Config) error {
+	tlsConn := tls.Client(c.raw, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.raw = tlsConn
+	c.r = bufio.NewReader(tlsConn)
+	c.w = bufio.NewWriter(tlsConn)
+	return nil
+}
+
+var literalSuffix = regexp.MustCompile(`\{(\d+)\+?\}$`)
+
+// readLine reads a response line, inlining any string literals it announces.
+func (c *conn) readLine() (string, error) {
+	var b strings.Builder
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		m := literalSuffix.FindStringSubmatchIndex(line)
+		if m == nil {
+			b.WriteString(line)
+			return b.String(), nil
+		}
+		size, err := strconv.Atoi(line[m[2]:m[3]])
+		if err != nil {
+			return "", fmt.Errorf("invalid literal size in %q", line)
+		}
+		b.WriteString(line[:m[0]])
+		literal := make([]byte, size)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return "", err
+		}
+		b.WriteString(strconv.Quote(string(literal)))
+	}
+}
+
+// readResponse reads data lines up to the final OK, NO or BYE line. NO and BYE are
+// returned as errors carrying the server's text.
+func (c *conn) readResponse() ([]string, error) {
+	var lines []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return lines, err
+		}
+
+		status, _, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(status) {
+		case "OK":
+			return lines, nil
+		case "NO", "BYE":
+			return lines, fmt.Errorf("server replied: %s", line)
+		}
+		lines = append(lines, line)
+	}
+}
+
+// cmd sends a command line and reads its response.
+func (c *conn) cmd(format string, args ...any) ([]string, error) {
+	if _, err := fmt.Fprintf(c.w, format+"\r\n", args...); err != nil {
+		return nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return c.readResponse()
+}
+
+// quoted returns the quoted strings of a response line in order.
+func quoted(line string) []string {
+	var values []string
+	for {
+		start := strings.IndexByte(line, '"')
+		if start < 0 {
+			return values
+		}
+		end := start + 1
+		for end < len(line) && line[end] != '"' {
+			if line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(line) {
+			return values
+		}
+		value, err := strconv.Unquote(line[start : end+1])
+		if err != nil {
+			value = line[start+1 : end]
+		}
+		values = append(values, value)
+		line = line[end+1:]
+	}
+}
+
+// capabilities parses capability lines such as `"SASL" "PLAIN LOGIN"` into a map keyed by
+// the upper-cased capability name.
+func capabilities(lines []string) map[string]string {
+	caps := make(map[string]string)
+	for _, line := range lines {
+		values := quoted(line)
+		if len(values) == 0 {
+			continue
+		}
+		value := ""
+		if len(values) > 1 {
+			value = values[1]
+		}
+		caps[strings.ToUpper(values[0])] = value
+	}
+	return caps
+}
+
+// literal formats s as a non-synchronizing literal, as required for client-sent scripts.
+func literal(s string) string {
+	return fmt.Sprintf("{%d+}\r\n%s", len(s), s)
+}
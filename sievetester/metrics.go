@@ -0,0 +1,87 @@
+package sievetester
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	timeToBanner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "sieve_time_to_banner_seconds",
+			Help:      "Time to receive the ManageSieve capability banner",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server"},
+	)
+	timeToStartTLS = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "sieve_time_to_starttls_seconds",
+			Help:      "Time to complete STARTTLS with the ManageSieve server",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server"},
+	)
+	timeToAuth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "sieve_time_to_auth_seconds",
+			Help:      "Time to authenticate to the ManageSieve server",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server"},
+	)
+	timeToList = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "sieve_time_to_listscripts_seconds",
+			Help:      "Time to list scripts on the ManageSieve server",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server"},
+	)
+	timeToPut = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "sieve_time_to_putscript_seconds",
+			Help:      "Time to upload a test script to the ManageSieve server",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server"},
+	)
+	timeToCheck = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "sieve_time_to_checkscript_seconds",
+			Help:      "Time to check a test script on the ManageSieve server",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server"},
+	)
+	sieveFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "sieve_failures_total",
+			Help:      "Total number of ManageSieve operation failures",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "operation"},
+	)
+)
+
+func init() {
+	metrics := []prometheus.Collector{
+		timeToBanner,
+		timeToStartTLS,
+		timeToAuth,
+		timeToList,
+		timeToPut,
+		timeToCheck,
+		sieveFailures,
+	}
+
+	for _, metric := range metrics {
+		if err := prometheus.Register(metric); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				prometheus.Unregister(are.ExistingCollector)
+				prometheus.MustRegister(metric)
+			} else {
+				logger.Error("Error registering metric", "error", err)
+			}
+		}
+	}
+}
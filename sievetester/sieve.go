@@ -0,0 +1,179 @@
+package sievetester
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/errclass"
+	"github.com/dniminenn/mailmetrix/results"
+)
+
+const (
+	testScriptName = "mailmetrix-test"
+	testScript     = "# mailmetrix test script\r\nkeep;\r\n"
+)
+
+// Tester checks a ManageSieve server: connect, STARTTLS, authenticate, LISTSCRIPTS and
+// optionally PUTSCRIPT, CHECKSCRIPT and DELETESCRIPT of a small test script.
+type Tester struct {
+	cfg config.SieveServerConfig
+}
+
+func (t *Tester) GetName() string {
+	return t.cfg.Name
+}
+
+func NewTester(cfg config.SieveServerConfig) *Tester {
+	return &Tester{cfg: cfg}
+}
+
+// If we don't clean up stale metrics, Prometheus will keep reporting the last value indefinitely.
+func (t *Tester) handleFailure(operation string, err error) {
+	t.log().Error("Operation failed", "operation", operation, "error_class", errclass.Classify(err), "error", err)
+	sieveFailures.WithLabelValues(t.cfg.Name, operation).Inc()
+	t.resetMetricsForOperation(operation)
+}
+
+func (t *Tester) resetMetricsForOperation(operation string) {
+	switch operation {
+	case "banner":
+		timeToBanner.WithLabelValues(t.cfg.Name).Set(math.NaN())
+	case "starttls":
+		timeToStartTLS.WithLabelValues(t.cfg.Name).Set(math.NaN())
+	case "authentication":
+		timeToAuth.WithLabelValues(t.cfg.Name).Set(math.NaN())
+	case "listscripts":
+		timeToList.WithLabelValues(t.cfg.Name).Set(math.NaN())
+	case "putscript":
+		timeToPut.WithLabelValues(t.cfg.Name).Set(math.NaN())
+	case "checkscript":
+		timeToCheck.WithLabelValues(t.cfg.Name).Set(math.NaN())
+	}
+}
+
+// RunSession runs the ManageSieve test session.
+func (t *Tester) RunSession(ctx context.Context) error {
+	address := net.JoinHostPort(t.cfg.Host, strconv.Itoa(t.cfg.Port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	raw, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		t.handleFailure("banner", err)
+		return fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	stop := context.AfterFunc(ctx, func() { raw.Close() })
+	defer stop()
+
+	c := newConn(raw)
+	defer func() {
+		c.cmd("LOGOUT")
+		c.raw.Close()
+	}()
+
+	start := time.Now()
+	lines, err := c.readResponse()
+	if err != nil {
+		t.handleFailure("banner", err)
+		return fmt.Errorf("failed to read capabilities: %w", err)
+	}
+	timeToBanner.WithLabelValues(t.cfg.Name).Set(time.Since(start).Seconds())
+	caps := capabilities(lines)
+
+	if _, ok := caps["STARTTLS"]; ok {
+		start = time.Now()
+		if caps, err = t.startTLS(c); err != nil {
+			t.handleFailure("starttls", err)
+			return fmt.Errorf("starttls failed: %w", err)
+		}
+		timeToStartTLS.WithLabelValues(t.cfg.Name).Set(time.Since(start).Seconds())
+		if tlsConn, ok := c.raw.(*tls.Conn); ok {
+			results.FromContext(ctx).SetTLS(tlsConn.ConnectionState())
+		}
+	} else if t.cfg.AllowInsecureAuth {
+		t.log().Warn("Server does not offer STARTTLS, authenticating in cleartext", "operation", "starttls")
+		timeToStartTLS.WithLabelValues(t.cfg.Name).Set(math.NaN())
+	} else {
+		err := errclass.Errorf(errclass.TLS, "server does not offer STARTTLS")
+		t.handleFailure("starttls", err)
+		return err
+	}
+
+	start = time.Now()
+	if err := t.authenticate(c, caps["SASL"]); err != nil {
+		t.handleFailure("authentication", err)
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+	timeToAuth.WithLabelValues(t.cfg.Name).Set(time.Since(start).Seconds())
+
+	start = time.Now()
+	if _, err := c.cmd("LISTSCRIPTS"); err != nil {
+		t.handleFailure("listscripts", err)
+		return fmt.Errorf("listscripts failed: %w", err)
+	}
+	timeToList.WithLabelValues(t.cfg.Name).Set(time.Since(start).Seconds())
+
+	if t.cfg.UploadScript {
+		return t.scriptTest(c)
+	}
+	return nil
+}
+
+// startTLS upgrades the connection and returns the capabilities the server re-announces.
+func (t *Tester) startTLS(c *conn) (map[string]string, error) {
+	if _, err := c.cmd("STARTTLS"); err != nil {
+		return nil, err
+	}
+	if err := c.startTLS(&tls.Config{
+		ServerName:         t.cfg.Host,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+	}); err != nil {
+		return nil, err
+	}
+	lines, err := c.readResponse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capabilities after tls: %w", err)
+	}
+	return capabilities(lines), nil
+}
+
+// authenticate logs in with SASL PLAIN, the mechanism every ManageSieve server must offer over TLS.
+func (t *Tester) authenticate(c *conn, mechanisms string) error {
+	if !strings.Contains(" "+strings.ToUpper(mechanisms)+" ", " PLAIN ") {
+		return fmt.Errorf("server does not offer SASL PLAIN (offered: %q)", mechanisms)
+	}
+	credentials := base64.StdEncoding.EncodeToString([]byte("\x00" + t.cfg.Username + "\x00" + t.cfg.Password))
+	_, err := c.cmd(`AUTHENTICATE "PLAIN" "%s"`, credentials)
+	return err
+}
+
+// scriptTest uploads the test script, checks it and removes it again.
+func (t *Tester) scriptTest(c *conn) error {
+	start := time.Now()
+	if _, err := c.cmd("PUTSCRIPT %q %s", testScriptName, literal(testScript)); err != nil {
+		t.handleFailure("putscript", err)
+		return fmt.Errorf("putscript failed: %w", err)
+	}
+	timeToPut.WithLabelValues(t.cfg.Name).Set(time.Since(start).Seconds())
+
+	start = time.Now()
+	if _, err := c.cmd("CHECKSCRIPT %s", literal(testScript)); err != nil {
+		t.handleFailure("checkscript", err)
+		c.cmd("DELETESCRIPT %q", testScriptName)
+		return fmt.Errorf("checkscript failed: %w", err)
+	}
+	timeToCheck.WithLabelValues(t.cfg.Name).Set(time.Since(start).Seconds())
+
+	if _, err := c.cmd("DELETESCRIPT %q", testScriptName); err != nil {
+		t.handleFailure("deletescript", err)
+		return fmt.Errorf("deletescript failed: %w", err)
+	}
+	return nil
+}
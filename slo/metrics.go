@@ -0,0 +1,63 @@
+package slo
+
+import (
+	"github.com/dniminenn/mailmetrix/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var logger = logging.New("slo")
+
+var (
+	sloTarget = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "slo_target_ratio",
+			Help:      "Target ratio of successful probe sessions of the objective",
+			Namespace: "mailmetrix",
+		},
+		[]string{"objective"},
+	)
+	sloCompliance = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "slo_success_ratio",
+			Help:      "Ratio of successful probe sessions over the compliance period",
+			Namespace: "mailmetrix",
+		},
+		[]string{"objective"},
+	)
+	sloErrorBudgetRemaining = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "slo_error_budget_remaining_ratio",
+			Help:      "Fraction of the error budget left over the compliance period; negative once exhausted",
+			Namespace: "mailmetrix",
+		},
+		[]string{"objective"},
+	)
+	sloBurnRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "slo_burn_rate",
+			Help:      "Error ratio over the window divided by the error budget ratio",
+			Namespace: "mailmetrix",
+		},
+		[]string{"objective", "window"},
+	)
+)
+
+func init() {
+	metrics := []prometheus.Collector{
+		sloTarget,
+		sloCompliance,
+		sloErrorBudgetRemaining,
+		sloBurnRate,
+	}
+
+	for _, metric := range metrics {
+		if err := prometheus.Register(metric); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				prometheus.Unregister(are.ExistingCollector)
+				prometheus.MustRegister(metric)
+			} else {
+				logger.Error("Error registering metric", "error", err)
+			}
+		}
+	}
+}
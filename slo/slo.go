@@ -0,0 +1,193 @@
+// Package slo tracks availability objectives over probe results and exports the remaining
+// error budget and multi-window burn rates. Counts are kept in memory in one-minute buckets,
+// so the history starts over when the process restarts.
+package slo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/results"
+)
+
+// burnRateWindows are the multi-window alerting windows from the SRE workbook.
+var burnRateWindows = []struct {
+	label   string
+	minutes int64
+}{
+	{"5m", 5},
+	{"30m", 30},
+	{"1h", 60},
+	{"6h", 6 * 60},
+	{"1d", 24 * 60},
+	{"3d", 3 * 24 * 60},
+}
+
+type bucket struct {
+	minute   int64
+	attempts uint32
+	failures uint32
+}
+
+// window keeps the running totals of the last minutes of an objective. The compliance
+// period is the first window of every objective, followed by the burn-rate windows that fit
+// in it.
+type window struct {
+	label    string
+	minutes  int64
+	attempts uint64
+	failures uint64
+}
+
+// objective holds the per-minute counts of one objective for its compliance period.
+type objective struct {
+	cfg     config.SLOObjectiveConfig
+	buckets []bucket
+	windows []*window
+	// head is the latest minute the window totals have been advanced to.
+	head int64
+}
+
+// Tracker is a results.Observer that updates the objectives matching each result.
+type Tracker struct {
+	mu         sync.Mutex
+	objectives []*objective
+}
+
+func NewTracker(cfgs []config.SLOObjectiveConfig) *Tracker {
+	t := &Tracker{}
+	now := time.Now().Unix() / 60
+	for _, cfg := range cfgs {
+		period := int64(cfg.WindowDays) * 24 * 60
+		o := &objective{
+			cfg:     cfg,
+			buckets: make([]bucket, period),
+			windows: []*window{{minutes: period}},
+			head:    now,
+		}
+		for _, w := range burnRateWindows {
+			if w.minutes <= period {
+				o.windows = append(o.windows, &window{label: w.label, minutes: w.minutes})
+			}
+		}
+		t.objectives = append(t.objectives, o)
+		sloTarget.WithLabelValues(cfg.Name).Set(cfg.Target / 100)
+	}
+	return t
+}
+
+// Start refreshes the metrics of every objective each minute until ctx is done, so the
+// windows keep sliding when no results arrive.
+func (t *Tracker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				t.refresh()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (t *Tracker) refresh() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now().Unix() / 60
+	for _, o := range t.objectives {
+		o.advance(now)
+		o.export()
+	}
+}
+
+// Observe counts the result against every objective it matches and refreshes their metrics.
+func (t *Tracker) Observe(r results.Result) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	minute := r.Time.Unix() / 60
+	now := time.Now().Unix() / 60
+	if minute > now {
+		minute = now
+	}
+	for _, o := range t.objectives {
+		if o.cfg.Kind != r.Kind || (o.cfg.Server != "" && o.cfg.Server != r.Server) {
+			continue
+		}
+		o.advance(now)
+		o.add(minute, r.Success())
+		o.export()
+	}
+}
+
+// advance slides the windows to now, subtracting the buckets that fell out of each.
+func (o *objective) advance(now int64) {
+	if now <= o.head {
+		return
+	}
+	for _, w := range o.windows {
+		if now-o.head >= w.minutes {
+			w.attempts, w.failures = 0, 0
+			continue
+		}
+		for m := o.head - w.minutes + 1; m <= now-w.minutes; m++ {
+			b := o.buckets[m%int64(len(o.buckets))]
+			if b.minute == m {
+				w.attempts -= uint64(b.attempts)
+				w.failures -= uint64(b.failures)
+			}
+		}
+	}
+	o.head = now
+}
+
+// add counts a result of the given minute, which must not be after the head, in its bucket
+// and in every window still covering it. Results older than the compliance period are
+// dropped.
+func (o *objective) add(minute int64, success bool) {
+	if minute <= o.head-int64(len(o.buckets)) {
+		return
+	}
+	b := &o.buckets[minute%int64(len(o.buckets))]
+	if b.minute != minute {
+		*b = bucket{minute: minute}
+	}
+	b.attempts++
+	if !success {
+		b.failures++
+	}
+	for _, w := range o.windows {
+		if minute > o.head-w.minutes {
+			w.attempts++
+			if !success {
+				w.failures++
+			}
+		}
+	}
+}
+
+func (o *objective) export() {
+	budget := 1 - o.cfg.Target/100
+
+	period := o.windows[0]
+	if period.attempts > 0 {
+		errorRatio := float64(period.failures) / float64(period.attempts)
+		sloCompliance.WithLabelValues(o.cfg.Name).Set(1 - errorRatio)
+		sloErrorBudgetRemaining.WithLabelValues(o.cfg.Name).Set(1 - errorRatio/budget)
+	}
+
+	for _, w := range o.windows[1:] {
+		rate := 0.0
+		if w.attempts > 0 {
+			rate = float64(w.failures) / float64(w.attempts) / budget
+		}
+		sloBurnRate.WithLabelValues(o.cfg.Name, w.label).Set(rate)
+	}
+}
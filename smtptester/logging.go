@@ -0,0 +1,14 @@
+package smtptester
+
+import (
+	"log/slog"
+
+	"github.com/dniminenn/mailmetrix/logging"
+)
+
+var logger = logging.New("smtp")
+
+// log returns the logger with the attributes identifying this tester and MX host.
+func (t *Tester) log(mx string) *slog.Logger {
+	return logger.With("server", t.cfg.Name, "mx", mx, "type", "smtp")
+}
@@ -0,0 +1,69 @@
+package smtptester
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	timeToBanner = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "smtp_time_to_banner_seconds",
+			Help:      "Time to receive the SMTP banner from the MX host",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "mx"},
+	)
+	timeToEhlo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "smtp_time_to_ehlo_seconds",
+			Help:      "Time to complete EHLO with the MX host",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "mx"},
+	)
+	timeToStartTLS = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "smtp_time_to_starttls_seconds",
+			Help:      "Time to complete STARTTLS and the TLS handshake with the MX host",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "mx"},
+	)
+	replyCode = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "smtp_reply_code",
+			Help:      "Last SMTP reply code received from the MX host for each step",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "mx", "step", "code"},
+	)
+	smtpFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:      "smtp_failures_total",
+			Help:      "Total number of SMTP operation failures",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "mx", "step"},
+	)
+)
+
+func init() {
+	metrics := []prometheus.Collector{
+		timeToBanner,
+		timeToEhlo,
+		timeToStartTLS,
+		replyCode,
+		smtpFailures,
+	}
+
+	for _, metric := range metrics {
+		if err := prometheus.Register(metric); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				prometheus.Unregister(are.ExistingCollector)
+				prometheus.MustRegister(metric)
+			} else {
+				logger.Error("Error registering metric", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package smtptester
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/dnstester"
+	"github.com/dniminenn/mailmetrix/errclass"
+	"github.com/dniminenn/mailmetrix/results"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// commandTimeout bounds every step of the conversation, so a stalled MX host fails its
+// step instead of holding the session until the global timeout.
+const commandTimeout = 30 * time.Second
+
+// Tester checks that the MX hosts of a domain accept mail from the outside on port 25.
+type Tester struct {
+	cfg      config.SMTPServerConfig
+	resolver *net.Resolver
+}
+
+func (t *Tester) GetName() string {
+	return t.cfg.Name
+}
+
+// NewTester creates a tester resolving MX hosts with the DNS server at resolverAddress, or
+// the system resolver if it is empty.
+func NewTester(cfg config.SMTPServerConfig, resolverAddress string) *Tester {
+	return &Tester{cfg: cfg, resolver: dnstester.NewResolver(resolverAddress)}
+}
+
+func (t *Tester) handleFailure(mx, step string, err error) {
+	t.log(mx).Error("Step failed", "operation", step, "error_class", errclass.Classify(err), "error", err)
+	smtpFailures.WithLabelValues(t.cfg.Name, mx, step).Inc()
+	t.resetMetricsForStep(mx, step)
+}
+
+func (t *Tester) resetMetricsForStep(mx, step string) {
+	switch step {
+	case "connect", "banner":
+		timeToBanner.WithLabelValues(t.cfg.Name, mx).Set(math.NaN())
+		timeToEhlo.WithLabelValues(t.cfg.Name, mx).Set(math.NaN())
+		timeToStartTLS.WithLabelValues(t.cfg.Name, mx).Set(math.NaN())
+	case "ehlo":
+		timeToEhlo.WithLabelValues(t.cfg.Name, mx).Set(math.NaN())
+	case "starttls":
+		timeToStartTLS.WithLabelValues(t.cfg.Name, mx).Set(math.NaN())
+	}
+}
+
+// RunSession probes every MX host of the domain in turn.
+func (t *Tester) RunSession(ctx context.Context) error {
+	hosts, err := t.mxHosts(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, mx := range hosts {
+		if err := t.probe(ctx, mx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", mx, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// mxHosts returns the configured hosts, or the MX hosts of the domain in preference order.
+func (t *Tester) mxHosts(ctx context.Context) ([]string, error) {
+	if len(t.cfg.Hosts) > 0 {
+		return t.cfg.Hosts, nil
+	}
+
+	mxs, err := t.resolver.LookupMX(ctx, t.cfg.Domain)
+	if err != nil {
+		t.handleFailure("", "mx_lookup", err)
+		return nil, fmt.Errorf("mx lookup for %s failed: %w", t.cfg.Domain, err)
+	}
+	sort.SliceStable(mxs, func(i, j int) bool { return mxs[i].Pref < mxs[j].Pref })
+
+	hosts := make([]string, 0, len(mxs))
+	for _, mx := range mxs {
+		hosts = append(hosts, strings.TrimSuffix(mx.Host, "."))
+	}
+	return hosts, nil
+}
+
+// session wraps a single SMTP conversation with one MX host.
+type session struct {
+	t    *Tester
+	mx   string
+	conn net.Conn
+	text *textproto.Conn
+}
+
+// readReply reads a reply for step and records its code, even when it is not the expected one.
+// A two-digit expect accepts the whole class, as in textproto.
+func (s *session) readReply(step string, expect int) (string, error) {
+	s.conn.SetDeadline(time.Now().Add(commandTimeout))
+	code, msg, err := s.text.ReadResponse(expect)
+	replyCode.DeletePartialMatch(prometheus.Labels{"server": s.t.cfg.Name, "mx": s.mx, "step": step})
+	if code > 0 {
+		replyCode.WithLabelValues(s.t.cfg.Name, s.mx, step, strconv.Itoa(code)).Set(1)
+	}
+	if err != nil {
+		s.t.handleFailure(s.mx, step, err)
+		return "", fmt.Errorf("%s failed: %w", step, err)
+	}
+	return msg, nil
+}
+
+func (s *session) cmd(step string, expect int, format string, args ...any) (string, error) {
+	s.conn.SetDeadline(time.Now().Add(commandTimeout))
+	if err := s.text.PrintfLine(format, args...); err != nil {
+		s.t.handleFailure(s.mx, step, err)
+		return "", fmt.Errorf("%s failed: %w", step, err)
+	}
+	return s.readReply(step, expect)
+}
+
+// ehlo sends EHLO and returns the advertised extension keywords in upper case.
+func (s *session) ehlo() (map[string]bool, error) {
+	msg, err := s.cmd("ehlo", 250, "EHLO %s", s.t.cfg.Helo)
+	if err != nil {
+		return nil, err
+	}
+
+	extensions := make(map[string]bool)
+	lines := strings.Split(msg, "\n")
+	for _, line := range lines[1:] {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			extensions[strings.ToUpper(fields[0])] = true
+		}
+	}
+	return extensions, nil
+}
+
+// probe runs banner, EHLO, STARTTLS (when offered), MAIL FROM and RCPT TO against one MX
+// host, then either finishes the transaction with DATA or abandons it with RSET.
+func (t *Tester) probe(ctx context.Context, mx string) error {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Resolver: t.resolver}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(mx, strconv.Itoa(t.cfg.Port)))
+	if err != nil {
+		t.handleFailure(mx, "connect", err)
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	s := &session{t: t, mx: mx, conn: conn, text: textproto.NewConn(conn)}
+
+	start := time.Now()
+	if _, err := s.readReply("banner", 220); err != nil {
+		return err
+	}
+	timeToBanner.WithLabelValues(t.cfg.Name, mx).Set(time.Since(start).Seconds())
+
+	start = time.Now()
+	extensions, err := s.ehlo()
+	if err != nil {
+		return err
+	}
+	timeToEhlo.WithLabelValues(t.cfg.Name, mx).Set(time.Since(start).Seconds())
+
+	if extensions["STARTTLS"] {
+		start = time.Now()
+		if _, err := s.cmd("starttls", 220, "STARTTLS"); err != nil {
+			return err
+		}
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         mx,
+			InsecureSkipVerify: true,
+			MinVersion:         tls.VersionTLS12,
+		})
+		conn.SetDeadline(time.Now().Add(commandTimeout))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			t.handleFailure(mx, "starttls", err)
+			return fmt.Errorf("tls handshake failed: %w", err)
+		}
+		results.FromContext(ctx).SetTLS(tlsConn.ConnectionState())
+		s.conn, s.text = tlsConn, textproto.NewConn(tlsConn)
+		if _, err := s.ehlo(); err != nil {
+			return err
+		}
+		timeToStartTLS.WithLabelValues(t.cfg.Name, mx).Set(time.Since(start).Seconds())
+	} else {
+		t.log(mx).Warn("Server does not offer STARTTLS", "operation", "starttls")
+		timeToStartTLS.WithLabelValues(t.cfg.Name, mx).Set(math.NaN())
+	}
+
+	if _, err := s.cmd("mail", 250, "MAIL FROM:<%s>", t.cfg.MailFrom); err != nil {
+		return err
+	}
+	// 251 (user not local, will forward) accepts the recipient as well.
+	if _, err := s.cmd("rcpt", 25, "RCPT TO:<%s>", t.cfg.RcptTo); err != nil {
+		return err
+	}
+
+	if t.cfg.SendData {
+		if err := s.data(t.testMessage()); err != nil {
+			return err
+		}
+	} else if _, err := s.cmd("rset", 250, "RSET"); err != nil {
+		return err
+	}
+
+	s.conn.SetDeadline(time.Now().Add(commandTimeout))
+	s.text.PrintfLine("QUIT")
+	s.text.ReadResponse(221)
+	return nil
+}
+
+func (s *session) data(message string) error {
+	if _, err := s.cmd("data", 354, "DATA"); err != nil {
+		return err
+	}
+
+	s.conn.SetDeadline(time.Now().Add(commandTimeout))
+	w := s.text.DotWriter()
+	if _, err := w.Write([]byte(message)); err != nil {
+		s.t.handleFailure(s.mx, "data", err)
+		return fmt.Errorf("data failed: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		s.t.handleFailure(s.mx, "data", err)
+		return fmt.Errorf("data failed: %w", err)
+	}
+
+	_, err := s.readReply("data_end", 250)
+	return err
+}
+
+// ProbeHeader carries a unique token in every delivered test message, so the receiving
+// side can find it again.
+const ProbeHeader = "X-Mailmetrix-Probe"
+
+func (t *Tester) testMessage() string {
+	now := time.Now()
+	return fmt.Sprintf("From: %s\r\n", t.cfg.MailFrom) +
+		fmt.Sprintf("To: %s\r\n", t.cfg.RcptTo) +
+		"Subject: mailmetrix-test\r\n" +
+		fmt.Sprintf("Date: %s\r\n", now.Format(time.RFC1123Z)) +
+		fmt.Sprintf("Message-ID: <%d.mailmetrix@%s>\r\n", now.UnixNano(), t.cfg.Helo) +
+		fmt.Sprintf("%s: %s/%d\r\n", ProbeHeader, t.cfg.Name, now.UnixNano()) +
+		"\r\n" +
+		"This is a test message for SMTP testing purposes.\r\n"
+}
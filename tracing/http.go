@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dniminenn/mailmetrix/errclass"
+	"github.com/dniminenn/mailmetrix/results"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Operation runs one operation of a session in its own span. The operation records its
+// failure reason on the span through Fail, as the testers' handleFailure does.
+func Operation(ctx context.Context, tracer trace.Tracer, name string, operation func(context.Context) error) error {
+	ctx, span := tracer.Start(ctx, name)
+	defer span.End()
+
+	err := operation(ctx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// FailSession marks the span of a session failed with err. The span carries the reason of
+// the failed step, as the session result of ctx does, or the reason of err if no step
+// failed.
+func FailSession(ctx context.Context, span trace.Span, err error) {
+	reason := results.FromContext(ctx).Reason()
+	if reason == "" {
+		reason = errclass.Classify(err)
+	}
+	Fail(span, reason, err)
+}
+
+// Transport records a client span with the method, status and body sizes of every request.
+type Transport struct {
+	http.RoundTripper
+	Tracer trace.Tracer
+}
+
+func (t Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.Tracer.Start(req.Context(), "HTTP "+req.Method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(req.URL.Redacted()),
+			semconv.ServerAddress(req.URL.Hostname()),
+		))
+	defer span.End()
+	if req.ContentLength > 0 {
+		span.SetAttributes(semconv.HTTPRequestBodySize(int(req.ContentLength)))
+	}
+
+	resp, err := t.RoundTripper.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		Fail(span, errclass.Classify(err), err)
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.ContentLength >= 0 {
+		span.SetAttributes(semconv.HTTPResponseBodySize(int(resp.ContentLength)))
+	}
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,100 @@
+package transcript
+
+import (
+	"regexp"
+	"strings"
+)
+
+const masked = "***"
+
+// IMAP lines are prefixed with their direction, and with the address when every address
+// of a host is probed, such as "[192.0.2.1] C: ".
+const (
+	imapClient = `^((?:\[[^\]]+\] )?C: )`
+	imapServer = `^((?:\[[^\]]+\] )?S: )`
+)
+
+var (
+	// imapLiteralLogin matches a LOGIN command ending in a literal, whose value the client
+	// sends on the next line.
+	imapLiteralLogin = regexp.MustCompile(`(?i)` + imapClient + `\S+ LOGIN .*\{\d+\+?\}$`)
+	// imapLogin matches a LOGIN command, keeping the tag and user name.
+	imapLogin = regexp.MustCompile(`(?i)` + imapClient + `(\S+ LOGIN (?:"(?:[^"\\]|\\.)*"|\S+)) .*$`)
+	// imapAuthenticate matches an AUTHENTICATE command, keeping the mechanism.
+	imapAuthenticate = regexp.MustCompile(`(?i)` + imapClient + `(\S+ AUTHENTICATE \S+)( .*)?$`)
+	// imapContinuation matches any other line sent by the client.
+	imapContinuation = regexp.MustCompile(imapClient)
+	// imapTagged matches a tagged server response, which ends an AUTHENTICATE exchange.
+	imapTagged = regexp.MustCompile(imapServer + `[^*+ ]\S* `)
+
+	// httpHeader matches the HTTP headers carrying credentials or session state.
+	httpHeader = regexp.MustCompile(`(?i)^([<>] (?:authorization|proxy-authorization|www-authenticate|proxy-authenticate|x-roundcube-auth|x-csrf-token|x-owa-canary): ?)(.*)$`)
+	// httpCookie matches the cookie headers, whose values are masked one by one.
+	httpCookie  = regexp.MustCompile(`(?i)^([<>] (cookie|set-cookie): ?)(.*)$`)
+	cookieValue = regexp.MustCompile(`(^|;\s*)([^=;\s]+)=[^;]*`)
+
+	// formField and jsonField match password and token parameters in request and response bodies.
+	formField = regexp.MustCompile(`(?i)\b(_?(?:user_)?pass(?:word|wd)?|_?token|request_token|_auth|access_token|refresh_token|client_secret)=[^&\s]*`)
+	jsonField = regexp.MustCompile(`(?i)("(?:_?pass(?:word|wd)?|_?token|request_token|access_token|refresh_token|client_secret)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+)
+
+// redact masks the passwords, tokens and cookies in a transcript.
+func redact(text string) string {
+	lines := strings.Split(text, "\n")
+	authenticating := false
+	for i, line := range lines {
+		switch {
+		case imapLiteralLogin.MatchString(line):
+			// The literals that follow carry the user name and password.
+			authenticating = true
+		case imapLogin.MatchString(line):
+			line = imapLogin.ReplaceAllString(line, "$1$2 "+masked)
+		case imapAuthenticate.MatchString(line):
+			// The initial response and every continuation the client sends carry credentials.
+			authenticating = true
+			if m := imapAuthenticate.FindStringSubmatch(line); m[3] != "" {
+				line = m[1] + m[2] + " " + masked
+			}
+		case authenticating && imapContinuation.MatchString(line):
+			line = imapContinuation.FindString(line) + masked
+		case authenticating && imapTagged.MatchString(line):
+			authenticating = false
+		case httpHeader.MatchString(line):
+			line = httpHeader.ReplaceAllStringFunc(line, maskHeader)
+		case httpCookie.MatchString(line):
+			line = maskCookies(line)
+		}
+		line = formField.ReplaceAllString(line, "$1="+masked)
+		line = jsonField.ReplaceAllString(line, `$1"`+masked+`"`)
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// maskHeader masks a credential header value, keeping the authentication scheme.
+func maskHeader(line string) string {
+	m := httpHeader.FindStringSubmatch(line)
+	name, value := m[1], m[2]
+	if scheme, _, ok := strings.Cut(value, " "); ok {
+		return name + scheme + " " + masked
+	}
+	return name + masked
+}
+
+// maskCookies masks every value of a Cookie header, and only the cookie value of a
+// Set-Cookie header so its attributes stay readable.
+func maskCookies(line string) string {
+	m := httpCookie.FindStringSubmatch(line)
+	prefix, header, value := m[1], m[2], m[3]
+	if !strings.EqualFold(header, "set-cookie") {
+		return prefix + cookieValue.ReplaceAllString(value, "$1$2="+masked)
+	}
+	pair, attributes, _ := strings.Cut(value, ";")
+	if name, _, ok := strings.Cut(pair, "="); ok {
+		pair = name + "=" + masked
+	}
+	if attributes != "" {
+		return prefix + pair + ";" + attributes
+	}
+	return prefix + pair
+}
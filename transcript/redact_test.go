@@ -0,0 +1,136 @@
+package transcript
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			"imap login quoted",
+			`C: a1 LOGIN "user@example.com" "p@ss word"`,
+			`C: a1 LOGIN "user@example.com" ***`,
+		},
+		{
+			"imap login atoms",
+			"C: a1 login user secret",
+			"C: a1 login user ***",
+		},
+		{
+			"imap login literal password",
+			"C: a1 LOGIN user {8}\nS: + Ready\nC: secret12\nS: a1 OK LOGIN completed",
+			"C: a1 LOGIN user {8}\nS: + Ready\nC: ***\nS: a1 OK LOGIN completed",
+		},
+		{
+			"imap login literal user and password",
+			"C: a1 LOGIN {4}\nS: + Ready\nC: user {8}\nS: + Ready\nC: secret12\nS: a1 OK done\nC: a2 SELECT INBOX",
+			"C: a1 LOGIN {4}\nS: + Ready\nC: ***\nS: + Ready\nC: ***\nS: a1 OK done\nC: a2 SELECT INBOX",
+		},
+		{
+			"imap authenticate initial response",
+			"C: a1 AUTHENTICATE PLAIN AHVzZXIAc2VjcmV0\nS: a1 OK done\nC: a2 SELECT INBOX",
+			"C: a1 AUTHENTICATE PLAIN ***\nS: a1 OK done\nC: a2 SELECT INBOX",
+		},
+		{
+			"imap authenticate continuations",
+			"C: a1 AUTHENTICATE LOGIN\nS: + VXNlcm5hbWU6\nC: dXNlcg==\nS: + UGFzc3dvcmQ6\nC: c2VjcmV0\nS: a1 OK done\nC: a2 LIST \"\" *",
+			"C: a1 AUTHENTICATE LOGIN\nS: + VXNlcm5hbWU6\nC: ***\nS: + UGFzc3dvcmQ6\nC: ***\nS: a1 OK done\nC: a2 LIST \"\" *",
+		},
+		{
+			"imap untagged response does not end authenticate",
+			"C: a1 AUTHENTICATE PLAIN\nS: * CAPABILITY IMAP4rev1\nC: AHVzZXIAc2VjcmV0",
+			"C: a1 AUTHENTICATE PLAIN\nS: * CAPABILITY IMAP4rev1\nC: ***",
+		},
+		{
+			"imap address prefix login",
+			`[192.0.2.1] C: a1 LOGIN user "secret"`,
+			`[192.0.2.1] C: a1 LOGIN user ***`,
+		},
+		{
+			"imap address prefix authenticate",
+			"[2001:db8::1] C: a1 AUTHENTICATE PLAIN\n[2001:db8::1] S: +\n[2001:db8::1] C: AHVzZXIAc2VjcmV0\n[2001:db8::1] S: a1 OK done",
+			"[2001:db8::1] C: a1 AUTHENTICATE PLAIN\n[2001:db8::1] S: +\n[2001:db8::1] C: ***\n[2001:db8::1] S: a1 OK done",
+		},
+		{
+			"http basic authorization",
+			"> Authorization: Basic dXNlcjpzZWNyZXQ=",
+			"> Authorization: Basic ***",
+		},
+		{
+			"http ntlm challenge and response",
+			"> Authorization: NTLM TlRMTVNTUAADAAAA\n< WWW-Authenticate: NTLM TlRMTVNTUAACAAAA",
+			"> Authorization: NTLM ***\n< WWW-Authenticate: NTLM ***",
+		},
+		{
+			"http header without scheme",
+			"> X-Roundcube-Auth: abcdef",
+			"> X-Roundcube-Auth: ***",
+		},
+		{
+			"http cookie",
+			"> Cookie: roundcube_sessid=abc; roundcube_sessauth=def",
+			"> Cookie: roundcube_sessid=***; roundcube_sessauth=***",
+		},
+		{
+			"http set-cookie keeps attributes",
+			"< Set-Cookie: roundcube_sessid=abc; path=/; secure; HttpOnly",
+			"< Set-Cookie: roundcube_sessid=***; path=/; secure; HttpOnly",
+		},
+		{
+			"roundcube login form",
+			"_token=abc123&_task=login&_action=login&_user=user%40example.com&_pass=s3cret",
+			"_token=***&_task=login&_action=login&_user=user%40example.com&_pass=***",
+		},
+		{
+			"json tokens",
+			`{"access_token": "abc", "refresh_token":"d\"ef", "password": "x", "expires_in": 3600}`,
+			`{"access_token": "***", "refresh_token":"***", "password": "***", "expires_in": 3600}`,
+		},
+		{
+			"unrelated lines",
+			"C: a3 FETCH 1:* (ENVELOPE)\n< Content-Type: text/html",
+			"C: a3 FETCH 1:* (ENVELOPE)\n< Content-Type: text/html",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redact(tt.in); got != tt.want {
+				t.Errorf("redact() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMask(t *testing.T) {
+	ctx, tr := NewContext(context.Background())
+	if FromContext(ctx) != tr {
+		t.Fatal("FromContext did not return the transcript")
+	}
+	tr.Mask("p@ss&word")
+	tr.Mask("")
+	tr.Append("C: ", []byte("a1 NOOP p@ss&word\r\n"))
+	tr.Append("> ", []byte("POST /?user=me&secret=p%40ss%26word\r\n"))
+
+	got := tr.String()
+	for _, secret := range []string{"p@ss&word", "p%40ss%26word"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("transcript contains %q:\n%s", secret, got)
+		}
+	}
+	want := "C: a1 NOOP ***\n> POST /?user=me&secret=***\n"
+	if got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	var nilTranscript *Transcript
+	nilTranscript.Mask("secret")
+	if nilTranscript.String() != "" {
+		t.Error("nil transcript is not empty")
+	}
+}
@@ -0,0 +1,74 @@
+package transcript
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry is a stored transcript of a failed session.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	Server     string    `json:"server"`
+	Error      string    `json:"error"`
+	Transcript string    `json:"transcript"`
+}
+
+// Store keeps the transcripts of the last failing sessions of every server.
+type Store struct {
+	keep    int
+	mu      sync.Mutex
+	entries map[string][]Entry
+}
+
+// NewStore returns a Store keeping up to keep transcripts per server.
+func NewStore(keep int) *Store {
+	return &Store{keep: keep, entries: make(map[string][]Entry)}
+}
+
+// Add stores the redacted transcript of a session that failed with err. Sessions that
+// recorded nothing, such as those of testers without transcript support, are ignored.
+func (s *Store) Add(kind, server string, start time.Time, err error, t *Transcript) {
+	if t.Empty() {
+		return
+	}
+	e := Entry{Time: start, Kind: kind, Server: server, Error: err.Error(), Transcript: t.String()}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := kind + "/" + server
+	list := append(s.entries[key], e)
+	if len(list) > s.keep {
+		list = list[len(list)-s.keep:]
+	}
+	s.entries[key] = list
+}
+
+// Handler serves GET /api/transcripts?server= as JSON, newest first.
+func (s *Store) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		server := r.URL.Query().Get("server")
+		entries := []Entry{}
+		s.mu.Lock()
+		for _, list := range s.entries {
+			for _, e := range list {
+				if server == "" || e.Server == server {
+					entries = append(entries, e)
+				}
+			}
+		}
+		s.mu.Unlock()
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Time.After(entries[j].Time) })
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	})
+}
@@ -0,0 +1,116 @@
+// Package transcript records the protocol exchange of a session in debug mode, so the
+// commands and responses leading up to a failure can be inspected afterwards.
+package transcript
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// maxSize bounds the recorded bytes of one session; anything beyond is dropped.
+const maxSize = 256 << 10
+
+// Transcript collects the lines exchanged during a session. Testers find it in the context
+// passed to RunSession; all methods are no-ops on a nil Transcript.
+type Transcript struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	prefix    string
+	midLine   bool
+	truncated bool
+	secrets   []string
+}
+
+type transcriptKey struct{}
+
+// NewContext returns a context carrying a new Transcript.
+func NewContext(ctx context.Context) (context.Context, *Transcript) {
+	t := &Transcript{}
+	return context.WithValue(ctx, transcriptKey{}, t), t
+}
+
+// FromContext returns the Transcript of the context, or nil.
+func FromContext(ctx context.Context) *Transcript {
+	t, _ := ctx.Value(transcriptKey{}).(*Transcript)
+	return t
+}
+
+// Append records p, marking each line with prefix, such as "C: " for what the client sent.
+func (t *Transcript) Append(prefix string, p []byte) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.midLine && prefix != t.prefix {
+		t.buf.WriteByte('\n')
+		t.midLine = false
+	}
+	t.prefix = prefix
+	for len(p) > 0 {
+		if t.buf.Len() >= maxSize {
+			t.truncated = true
+			return
+		}
+		if !t.midLine {
+			t.buf.WriteString(prefix)
+		}
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			t.buf.Write(p)
+			t.midLine = true
+			return
+		}
+		t.buf.Write(p[:i+1])
+		p = p[i+1:]
+		t.midLine = false
+	}
+}
+
+// Mask registers a secret, such as the configured password, that is masked wherever it appears.
+func (t *Transcript) Mask(secret string) {
+	if t == nil || secret == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range []string{secret, url.QueryEscape(secret)} {
+		if !slices.Contains(t.secrets, s) {
+			t.secrets = append(t.secrets, s)
+		}
+	}
+}
+
+// Empty reports whether nothing was recorded.
+func (t *Transcript) Empty() bool {
+	if t == nil {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.buf.Len() == 0
+}
+
+// String returns the redacted transcript.
+func (t *Transcript) String() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	text := strings.ReplaceAll(t.buf.String(), "\r\n", "\n")
+	for _, secret := range t.secrets {
+		text = strings.ReplaceAll(text, secret, masked)
+	}
+	text = redact(text)
+	if t.truncated {
+		text += "[transcript truncated]\n"
+	}
+	return text
+}
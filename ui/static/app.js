@@ -0,0 +1,159 @@
+"use strict";
+
+const refreshInterval = 10000;
+
+function el(tag, className, text) {
+  const node = document.createElement(tag);
+  if (className) node.className = className;
+  if (text !== undefined) node.textContent = text;
+  return node;
+}
+
+function formatSeconds(seconds) {
+  if (seconds < 1) return Math.round(seconds * 1000) + " ms";
+  return seconds.toFixed(2) + " s";
+}
+
+function formatTime(value) {
+  return new Date(value).toLocaleString();
+}
+
+// sparkline draws one bar per run, scaled by duration and colored by outcome.
+function sparkline(runs) {
+  const ns = "http://www.w3.org/2000/svg";
+  const width = 150, height = 24, bar = width / 50;
+  const svg = document.createElementNS(ns, "svg");
+  svg.setAttribute("width", width);
+  svg.setAttribute("height", height);
+
+  const longest = Math.max(...runs.map((r) => r.duration_seconds), 0.001);
+  runs.forEach((run, i) => {
+    const h = Math.max(2, (run.duration_seconds / longest) * height);
+    const rect = document.createElementNS(ns, "rect");
+    rect.setAttribute("x", i * bar);
+    rect.setAttribute("y", height - h);
+    rect.setAttribute("width", Math.max(1, bar - 1));
+    rect.setAttribute("height", h);
+    rect.setAttribute("fill", run.success ? "#1a7f37" : "#cf222e");
+    const title = document.createElementNS(ns, "title");
+    title.textContent = formatTime(run.time * 1000) + " " + formatSeconds(run.duration_seconds);
+    rect.appendChild(title);
+    svg.appendChild(rect);
+  });
+  return svg;
+}
+
+function stepList(entry) {
+  const list = el("ul", "steps");
+  for (const step of entry.steps || []) {
+    if (step.error) {
+      list.appendChild(el("li", "failed", step.name + ": " + step.reason));
+    } else {
+      list.appendChild(el("li", "", step.name + ": " + formatSeconds(step.duration_seconds)));
+    }
+  }
+  return list;
+}
+
+async function runNow(target, button) {
+  button.disabled = true;
+  const body = new URLSearchParams({ kind: target.kind, server: target.server });
+  const response = await fetch("api/run", { method: "POST", body });
+  if (!response.ok) {
+    alert(await response.text());
+    button.disabled = false;
+    return;
+  }
+  button.textContent = "Started";
+  setTimeout(refresh, 2000);
+}
+
+function row(target) {
+  const tr = el("tr");
+  const latest = target.latest;
+
+  const status = latest ? (latest.success ? "up" : "down") : "pending";
+  const statusCell = el("td");
+  statusCell.appendChild(el("span", "status " + status, status));
+  tr.appendChild(statusCell);
+
+  tr.appendChild(el("td", "", target.kind));
+  tr.appendChild(el("td", "", target.server));
+
+  const last = el("td");
+  if (latest) {
+    last.appendChild(el("div", "", formatTime(latest.time)));
+    last.appendChild(el("div", "muted", formatSeconds(latest.duration_seconds)));
+    if (latest.tls) last.appendChild(el("div", "muted", latest.tls));
+  }
+  tr.appendChild(last);
+
+  const steps = el("td");
+  if (latest) steps.appendChild(stepList(latest));
+  tr.appendChild(steps);
+
+  const recent = el("td");
+  if (target.recent.length > 0) recent.appendChild(sparkline(target.recent));
+  tr.appendChild(recent);
+
+  const error = el("td", "error");
+  if (target.last_error) {
+    error.appendChild(el("div", "", target.last_error.error));
+    error.appendChild(el("div", "muted", formatTime(target.last_error.time) + " (" + target.last_error.reason + ")"));
+  }
+  tr.appendChild(error);
+
+  const action = el("td");
+  const button = el("button", "", "Run now");
+  button.addEventListener("click", () => runNow(target, button));
+  action.appendChild(button);
+  tr.appendChild(action);
+
+  return tr;
+}
+
+// locationRow shows a target of the controller with the latest result from every location,
+// so a regional network problem stands out from an outage of the server.
+function locationRow(target) {
+  const tr = el("tr");
+  const statusCell = el("td");
+  statusCell.appendChild(el("span", "status " + target.status, target.status));
+  tr.appendChild(statusCell);
+  tr.appendChild(el("td", "", target.kind));
+  tr.appendChild(el("td", "", target.server));
+
+  const locations = el("td");
+  for (const result of target.locations) {
+    const state = result.stale ? "pending" : result.success ? "up" : "down";
+    const badge = el("span", "status location " + state, result.location);
+    badge.title = formatTime(result.time) + (result.error ? " " + result.error : "");
+    locations.appendChild(badge);
+  }
+  tr.appendChild(locations);
+  return tr;
+}
+
+// refreshLocations fills the locations table when this instance is a controller.
+async function refreshLocations() {
+  const response = await fetch("api/locations");
+  if (!response.ok) return;
+  const targets = await response.json();
+  document.getElementById("locations").replaceChildren(...targets.map(locationRow));
+  document.getElementById("locations-section").hidden = false;
+}
+
+async function refresh() {
+  try {
+    const response = await fetch("api/status");
+    const targets = await response.json();
+    const body = document.getElementById("targets");
+    body.replaceChildren(...targets.map(row));
+    await refreshLocations();
+    document.getElementById("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+  } catch (err) {
+    document.getElementById("updated").textContent = "Update failed: " + err;
+  }
+}
+
+refresh();
+setInterval(refresh, refreshInterval);
@@ -0,0 +1,158 @@
+// Package ui serves an embedded status page listing every probe target with its latest
+// result, step timings and recent history, and lets operators start a run on demand.
+package ui
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"sync"
+
+	"github.com/dniminenn/mailmetrix/results"
+)
+
+// recentRuns is how many results are kept per target for the sparkline.
+const recentRuns = 50
+
+//go:embed static
+var static embed.FS
+
+var (
+	// ErrBusy is returned by the run function while a run of the same kind is in progress.
+	ErrBusy = errors.New("tests of this kind are already running")
+	// ErrUnknownTarget is returned by the run function for a target that is not configured.
+	ErrUnknownTarget = errors.New("unknown target")
+)
+
+// Target identifies a configured tester.
+type Target struct {
+	Kind   string `json:"kind"`
+	Server string `json:"server"`
+}
+
+// Run is a point on the sparkline.
+type Run struct {
+	Time     int64   `json:"time"`
+	Success  bool    `json:"success"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+type targetStatus struct {
+	Target
+	Latest *results.Entry `json:"latest,omitempty"`
+	// LastError is kept after the target recovers, so the helpdesk can still see it.
+	LastError *results.Entry `json:"last_error,omitempty"`
+	Recent    []Run          `json:"recent"`
+}
+
+// Dashboard is a results.Observer that keeps the latest results of each target in memory.
+type Dashboard struct {
+	run func(kind, server string) error
+
+	mu       sync.Mutex
+	statuses []*targetStatus
+	index    map[Target]*targetStatus
+}
+
+// New creates a dashboard for the targets; run starts a session of one target on demand.
+func New(targets []Target, run func(kind, server string) error) *Dashboard {
+	d := &Dashboard{run: run}
+	d.SetTargets(targets)
+	return d
+}
+
+// SetTargets replaces the listed targets, keeping the results of those still configured.
+func (d *Dashboard) SetTargets(targets []Target) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	statuses := make([]*targetStatus, 0, len(targets))
+	index := make(map[Target]*targetStatus, len(targets))
+	for _, t := range targets {
+		if _, ok := index[t]; ok {
+			continue
+		}
+		status, ok := d.index[t]
+		if !ok {
+			status = &targetStatus{Target: t, Recent: []Run{}}
+		}
+		statuses = append(statuses, status)
+		index[t] = status
+	}
+	d.statuses = statuses
+	d.index = index
+}
+
+// Observe records the result of a configured target.
+func (d *Dashboard) Observe(r results.Result) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status, ok := d.index[Target{Kind: r.Kind, Server: r.Server}]
+	if !ok {
+		return
+	}
+	entry := r.Entry()
+	status.Latest = &entry
+	if !entry.Success {
+		status.LastError = &entry
+	}
+	status.Recent = append(status.Recent, Run{Time: entry.Time.Unix(), Success: entry.Success, Duration: entry.Duration})
+	if len(status.Recent) > recentRuns {
+		status.Recent = status.Recent[len(status.Recent)-recentRuns:]
+	}
+}
+
+// Handler serves the page at /, the target list at /api/status and on-demand runs at
+// POST /api/run?kind=&server=.
+func (d *Dashboard) Handler() http.Handler {
+	content, _ := fs.Sub(static, "static")
+	files := http.FileServer(http.FS(content))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", d.serveStatus)
+	mux.HandleFunc("/api/run", d.serveRun)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && r.URL.Path != "/app.js" && r.URL.Path != "/style.css" {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+	return mux
+}
+
+func (d *Dashboard) serveStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	d.mu.Lock()
+	body, err := json.Marshal(d.statuses)
+	d.mu.Unlock()
+	if err != nil {
+		http.Error(w, "failed to encode status", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func (d *Dashboard) serveRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch err := d.run(r.FormValue("kind"), r.FormValue("server")); {
+	case err == nil:
+		w.WriteHeader(http.StatusAccepted)
+	case errors.Is(err, ErrUnknownTarget):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrBusy):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
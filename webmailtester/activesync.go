@@ -0,0 +1,370 @@
+package webmailtester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/errclass"
+)
+
+const (
+	activeSyncDeviceID   = "MAILMETRIX0000001"
+	activeSyncDeviceType = "mailmetrix"
+	activeSyncInboxType  = "2"
+)
+
+// activeSyncMaxVersion is the highest protocol version the tester speaks.
+var activeSyncMaxVersion = activeSyncVersion{14, 1}
+
+// activeSyncVersion is a major.minor protocol version, as in MS-ASProtocolVersions.
+type activeSyncVersion struct {
+	major, minor int
+}
+
+func parseActiveSyncVersion(s string) (activeSyncVersion, bool) {
+	major, minor, ok := strings.Cut(strings.TrimSpace(s), ".")
+	if !ok {
+		return activeSyncVersion{}, false
+	}
+	v := activeSyncVersion{}
+	var err1, err2 error
+	v.major, err1 = strconv.Atoi(major)
+	v.minor, err2 = strconv.Atoi(minor)
+	return v, err1 == nil && err2 == nil && v.major >= 0 && v.minor >= 0
+}
+
+func (v activeSyncVersion) less(other activeSyncVersion) bool {
+	return v.major < other.major || (v.major == other.major && v.minor < other.minor)
+}
+
+func (v activeSyncVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+// negotiateVersion returns the highest advertised version up to activeSyncMaxVersion.
+func negotiateVersion(advertised string) (activeSyncVersion, bool) {
+	var best activeSyncVersion
+	found := false
+	for _, s := range strings.Split(advertised, ",") {
+		v, ok := parseActiveSyncVersion(s)
+		if !ok || activeSyncMaxVersion.less(v) {
+			continue
+		}
+		if !found || best.less(v) {
+			best, found = v, true
+		}
+	}
+	return best, found
+}
+
+// errProvisionRequired is returned for commands the server refuses until the device has
+// accepted its security policy.
+var errProvisionRequired = errors.New("server requires provisioning")
+
+// Command statuses asking the client to provision again (MS-ASCMD, common status codes).
+var provisionStatuses = map[string]bool{"142": true, "143": true, "144": true}
+
+// ActiveSyncTester probes Exchange ActiveSync: OPTIONS as login, FolderSync as listing and
+// an initial plus a GetChanges Sync of the inbox as message load. Servers enforcing a
+// security policy are answered with a Provision exchange before the command is retried.
+type ActiveSyncTester struct {
+	cfg             config.WebmailServerConfig
+	client          *http.Client
+	protocolVersion activeSyncVersion
+	inboxID         string
+	// policyKey is the key of the accepted security policy, kept across sessions like a
+	// device would.
+	policyKey string
+}
+
+func (a *ActiveSyncTester) GetName() string {
+	return a.cfg.Name
+}
+
+func NewActiveSyncTester(cfg config.WebmailServerConfig) WebmailTester {
+	return &ActiveSyncTester{
+		cfg:    cfg,
+		client: newExchangeClient(cfg),
+	}
+}
+
+func init() {
+	Register("activesync", NewActiveSyncTester)
+}
+
+func (a *ActiveSyncTester) RunSession(ctx context.Context) error {
+	defer func() { a.inboxID = "" }()
+
+	if err := traced(ctx, "login", a.login); err != nil {
+		webmailErrors.WithLabelValues(a.cfg.Name, "login").Inc()
+		return fmt.Errorf("login failed: %w", err)
+	}
+
+	if err := traced(ctx, "list", a.testListing); err != nil {
+		webmailErrors.WithLabelValues(a.cfg.Name, "listing").Inc()
+		return fmt.Errorf("listing test failed: %w", err)
+	}
+
+	if err := traced(ctx, "preview", a.testMessageLoad); err != nil {
+		webmailErrors.WithLabelValues(a.cfg.Name, "loading").Inc()
+		return fmt.Errorf("message load test failed: %w", err)
+	}
+
+	return nil
+}
+
+func (a *ActiveSyncTester) endpoint() string {
+	return strings.TrimSuffix(a.cfg.BaseURL, "/") + "/Microsoft-Server-ActiveSync"
+}
+
+// login sends OPTIONS and picks the highest protocol version up to 14.1 the server offers.
+func (a *ActiveSyncTester) login(ctx context.Context) error {
+	start := time.Now()
+	resp, err := exchangeRequest(ctx, a.client, a.cfg, "OPTIONS", a.endpoint(), "", nil, nil)
+	if err != nil {
+		handleFailure(ctx, a.cfg.Name, "login", err)
+		return err
+	}
+	resp.Body.Close()
+
+	version, ok := negotiateVersion(resp.Header.Get("MS-ASProtocolVersions"))
+	if !ok {
+		err := errclass.Errorf(errclass.UnexpectedContent, "server did not advertise a supported protocol version")
+		handleFailure(ctx, a.cfg.Name, "login", err)
+		return err
+	}
+	a.protocolVersion = version
+
+	observe(ctx, webmailLoginTime, a.cfg.Name, "login", time.Since(start))
+	return nil
+}
+
+func (a *ActiveSyncTester) testListing(ctx context.Context) error {
+	start := time.Now()
+	req := wbxmlElement(pageFolderHierarchy, tagFolderSync,
+		wbxmlText(pageFolderHierarchy, tagFolderSyncKey, "0"))
+
+	resp, err := a.command(ctx, "FolderSync", req)
+	if err != nil {
+		handleFailure(ctx, a.cfg.Name, "listing", err)
+		return err
+	}
+	if status := resp.childText(pageFolderHierarchy, tagFolderStatus); status != "1" {
+		err := fmt.Errorf("FolderSync returned status %s", status)
+		handleFailure(ctx, a.cfg.Name, "listing", err)
+		return err
+	}
+
+	for _, folder := range resp.findAll(pageFolderHierarchy, tagFolderAdd) {
+		if folder.childText(pageFolderHierarchy, tagFolderType) == activeSyncInboxType {
+			a.inboxID = folder.childText(pageFolderHierarchy, tagFolderServerID)
+			break
+		}
+	}
+	if a.inboxID == "" {
+		err := errclass.Errorf(errclass.UnexpectedContent, "FolderSync did not return an inbox")
+		handleFailure(ctx, a.cfg.Name, "listing", err)
+		return err
+	}
+
+	observe(ctx, webmailFirstPageTime, a.cfg.Name, "listing", time.Since(start))
+	return nil
+}
+
+func (a *ActiveSyncTester) testMessageLoad(ctx context.Context) error {
+	start := time.Now()
+
+	// An initial Sync with key 0 only returns the key to use for fetching items.
+	syncKey, err := a.sync(ctx, "0", false)
+	if err != nil {
+		handleFailure(ctx, a.cfg.Name, "loading", err)
+		return err
+	}
+	if _, err := a.sync(ctx, syncKey, true); err != nil {
+		handleFailure(ctx, a.cfg.Name, "loading", err)
+		return err
+	}
+
+	observe(ctx, webmailMessageLoadTime, a.cfg.Name, "loading", time.Since(start))
+	return nil
+}
+
+// sync runs a Sync on the inbox and returns the new sync key.
+func (a *ActiveSyncTester) sync(ctx context.Context, syncKey string, getChanges bool) (string, error) {
+	collection := wbxmlElement(pageAirSync, tagCollection,
+		wbxmlText(pageAirSync, tagSyncKey, syncKey),
+		wbxmlText(pageAirSync, tagCollectionID, a.inboxID))
+	if getChanges {
+		collection.children = append(collection.children,
+			wbxmlElement(pageAirSync, tagGetChanges),
+			wbxmlText(pageAirSync, tagWindowSize, "10"))
+	}
+	req := wbxmlElement(pageAirSync, tagSync, wbxmlElement(pageAirSync, tagCollections, collection))
+
+	resp, err := a.command(ctx, "Sync", req)
+	if err != nil {
+		return "", err
+	}
+	if resp == nil {
+		// Nothing changed, so the key stays valid; the initial Sync must return one.
+		if syncKey == "0" {
+			return "", errclass.Errorf(errclass.UnexpectedContent, "Sync returned an empty response")
+		}
+		return syncKey, nil
+	}
+	if status := resp.childText(pageAirSync, tagStatus); status != "1" {
+		return "", fmt.Errorf("Sync returned status %s", status)
+	}
+	newKey := resp.childText(pageAirSync, tagSyncKey)
+	if newKey == "" {
+		return "", errclass.Errorf(errclass.UnexpectedContent, "Sync did not return a sync key")
+	}
+	return newKey, nil
+}
+
+// command runs a WBXML command. If the server asks for provisioning, with HTTP 449 or a
+// provisioning status, the tester provisions and sends the command again.
+func (a *ActiveSyncTester) command(ctx context.Context, cmd string, body *wbxmlNode) (*wbxmlNode, error) {
+	resp, err := a.post(ctx, cmd, body)
+	if errors.Is(err, errProvisionRequired) || (err == nil && needsProvisioning(resp)) {
+		if err := a.provision(ctx); err != nil {
+			return nil, err
+		}
+		resp, err = a.post(ctx, cmd, body)
+		if err == nil && needsProvisioning(resp) {
+			err = errclass.Errorf(errclass.Auth, "%s still requires provisioning after Provision", cmd)
+		}
+	}
+	return resp, err
+}
+
+// needsProvisioning reports whether the top-level status of a command response asks the
+// client to provision.
+func needsProvisioning(resp *wbxmlNode) bool {
+	statusTags := map[byte]byte{pageAirSync: tagStatus, pageFolderHierarchy: tagFolderStatus}
+	if resp == nil {
+		return false
+	}
+	tag, ok := statusTags[resp.page]
+	return ok && provisionStatuses[resp.childText(resp.page, tag)]
+}
+
+// provision runs the two Provision requests of MS-ASPROV: the first returns the policy
+// with a temporary key, the acknowledgment exchanges it for the final key. A remote wipe
+// request is never acknowledged.
+func (a *ActiveSyncTester) provision(ctx context.Context) error {
+	policyType := "MS-EAS-Provisioning-WBXML"
+	if a.protocolVersion.major < 12 {
+		policyType = "MS-WAP-Provisioning-XML"
+	}
+
+	a.policyKey = ""
+	resp, err := a.post(ctx, "Provision", wbxmlElement(pageProvision, tagProvision,
+		wbxmlElement(pageProvision, tagPolicies,
+			wbxmlElement(pageProvision, tagPolicy,
+				wbxmlText(pageProvision, tagPolicyType, policyType)))))
+	if err != nil {
+		return fmt.Errorf("provision failed: %w", err)
+	}
+	tempKey, err := policyKey(resp)
+	if err != nil {
+		return err
+	}
+
+	a.policyKey = tempKey
+	resp, err = a.post(ctx, "Provision", wbxmlElement(pageProvision, tagProvision,
+		wbxmlElement(pageProvision, tagPolicies,
+			wbxmlElement(pageProvision, tagPolicy,
+				wbxmlText(pageProvision, tagPolicyType, policyType),
+				wbxmlText(pageProvision, tagPolicyKey, tempKey),
+				wbxmlText(pageProvision, tagProvisionStatus, "1")))))
+	if err != nil {
+		a.policyKey = ""
+		return fmt.Errorf("provision acknowledgment failed: %w", err)
+	}
+	finalKey, err := policyKey(resp)
+	if err != nil {
+		a.policyKey = ""
+		return err
+	}
+	a.policyKey = finalKey
+	loggerFrom(ctx, a.cfg.Name).Debug("Provisioned ActiveSync device", "operation", "provision")
+	return nil
+}
+
+// policyKey checks the statuses of a Provision response and returns its policy key.
+func policyKey(resp *wbxmlNode) (string, error) {
+	if resp.find(pageProvision, tagRemoteWipe) != nil {
+		return "", errclass.Errorf(errclass.Auth, "server requested a remote wipe")
+	}
+	if status := resp.childText(pageProvision, tagProvisionStatus); status != "1" {
+		return "", errclass.Errorf(errclass.Auth, "Provision returned status %s", status)
+	}
+	policy := resp.find(pageProvision, tagPolicy)
+	if policy == nil {
+		return "", errclass.Errorf(errclass.UnexpectedContent, "Provision did not return a policy")
+	}
+	if status := policy.childText(pageProvision, tagProvisionStatus); status != "1" {
+		return "", errclass.Errorf(errclass.Auth, "Provision returned policy status %s", status)
+	}
+	key := policy.childText(pageProvision, tagPolicyKey)
+	if key == "" {
+		return "", errclass.Errorf(errclass.UnexpectedContent, "Provision did not return a policy key")
+	}
+	return key, nil
+}
+
+// emptyResponseCommands may be answered with an empty body: MS-ASCMD lets the server reply
+// to a Sync with no pending changes without a body.
+var emptyResponseCommands = map[string]bool{"Sync": true}
+
+// post posts a WBXML command and decodes the WBXML response. For the commands in
+// emptyResponseCommands an empty body returns a nil response.
+func (a *ActiveSyncTester) post(ctx context.Context, cmd string, body *wbxmlNode) (*wbxmlNode, error) {
+	query := url.Values{
+		"Cmd":        {cmd},
+		"User":       {a.cfg.Username},
+		"DeviceId":   {activeSyncDeviceID},
+		"DeviceType": {activeSyncDeviceType},
+	}
+	header := http.Header{}
+	header.Set("MS-ASProtocolVersion", a.protocolVersion.String())
+	if a.policyKey != "" {
+		header.Set("X-MS-PolicyKey", a.policyKey)
+	}
+
+	resp, err := exchangeRequest(ctx, a.client, a.cfg, "POST", a.endpoint()+"?"+query.Encode(),
+		"application/vnd.ms-sync.wbxml", body.encode(), header)
+	var statusErr *errclass.HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == 449 {
+		return nil, errclass.New(errclass.Auth, fmt.Errorf("%s: %w", cmd, errProvisionRequired))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", cmd, err)
+	}
+	if len(data) == 0 {
+		if emptyResponseCommands[cmd] {
+			return nil, nil
+		}
+		return nil, errclass.Errorf(errclass.UnexpectedContent, "%s returned an empty response", cmd)
+	}
+	doc, err := decodeWBXML(data)
+	if err != nil {
+		return nil, errclass.New(errclass.UnexpectedContent, fmt.Errorf("invalid %s response: %w", cmd, err))
+	}
+	return doc, nil
+}
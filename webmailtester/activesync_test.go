@@ -0,0 +1,173 @@
+package webmailtester
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dniminenn/mailmetrix/config"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		advertised string
+		want       string
+		ok         bool
+	}{
+		{"2.5,12.0,12.1,14.0,14.1,16.0,16.1", "14.1", true},
+		{"2.5,12.0,12.1,14.0", "14.0", true},
+		{"14.0, 2.5", "14.0", true},
+		{"2.5,12.10,12.1", "12.10", true},
+		{"2.5", "2.5", true},
+		{"16.0,16.1", "", false},
+		{"", "", false},
+		{"abc,14,1.x", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := negotiateVersion(tt.advertised)
+		if ok != tt.ok || (ok && got.String() != tt.want) {
+			t.Errorf("negotiateVersion(%q) = %v, %v, want %s, %v", tt.advertised, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// activeSyncServer is an ActiveSync endpoint that requires provisioning with HTTP 449
+// before it serves FolderSync and Sync.
+type activeSyncServer struct {
+	t          *testing.T
+	provisions int
+	wipe       bool
+	// noChanges answers a Sync with a sync key other than 0 with an empty body.
+	noChanges bool
+}
+
+const (
+	testTempKey  = "1111"
+	testFinalKey = "2222"
+)
+
+func (s *activeSyncServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		w.Header().Set("MS-ASProtocolVersions", "2.5,12.0,12.1,14.0,14.1,16.0")
+		return
+	}
+	if v := r.Header.Get("MS-ASProtocolVersion"); v != "14.1" {
+		s.t.Errorf("MS-ASProtocolVersion = %q, want 14.1", v)
+	}
+	data, _ := io.ReadAll(r.Body)
+	req, err := decodeWBXML(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key := r.Header.Get("X-MS-PolicyKey")
+	var resp *wbxmlNode
+	switch r.URL.Query().Get("Cmd") {
+	case "Provision":
+		s.provisions++
+		policy := req.find(pageProvision, tagPolicy)
+		if policy.childText(pageProvision, tagPolicyKey) == "" {
+			resp = provisionResponse(testTempKey, s.wipe)
+		} else if policy.childText(pageProvision, tagPolicyKey) == testTempKey && key == testTempKey &&
+			policy.childText(pageProvision, tagProvisionStatus) == "1" {
+			resp = provisionResponse(testFinalKey, false)
+		} else {
+			http.Error(w, "bad acknowledgment", http.StatusBadRequest)
+			return
+		}
+	case "FolderSync", "Sync":
+		if key != testFinalKey {
+			w.WriteHeader(449)
+			return
+		}
+		if r.URL.Query().Get("Cmd") == "FolderSync" {
+			resp = wbxmlElement(pageFolderHierarchy, tagFolderSync,
+				wbxmlText(pageFolderHierarchy, tagFolderStatus, "1"),
+				wbxmlElement(pageFolderHierarchy, tagFolderAdd,
+					wbxmlText(pageFolderHierarchy, tagFolderServerID, "5"),
+					wbxmlText(pageFolderHierarchy, tagFolderType, activeSyncInboxType)))
+		} else if s.noChanges && req.find(pageAirSync, tagSyncKey).text != "0" {
+			w.Header().Set("Content-Type", "application/vnd.ms-sync.wbxml")
+			return
+		} else {
+			resp = wbxmlElement(pageAirSync, tagSync,
+				wbxmlElement(pageAirSync, tagCollections,
+					wbxmlElement(pageAirSync, tagCollection,
+						wbxmlText(pageAirSync, tagSyncKey, "1"),
+						wbxmlText(pageAirSync, tagCollectionID, "5"),
+						wbxmlText(pageAirSync, tagStatus, "1"))))
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.ms-sync.wbxml")
+	w.Write(resp.encode())
+}
+
+func provisionResponse(key string, wipe bool) *wbxmlNode {
+	resp := wbxmlElement(pageProvision, tagProvision,
+		wbxmlText(pageProvision, tagProvisionStatus, "1"),
+		wbxmlElement(pageProvision, tagPolicies,
+			wbxmlElement(pageProvision, tagPolicy,
+				wbxmlText(pageProvision, tagPolicyType, "MS-EAS-Provisioning-WBXML"),
+				wbxmlText(pageProvision, tagProvisionStatus, "1"),
+				wbxmlText(pageProvision, tagPolicyKey, key))))
+	if wipe {
+		resp.children = append(resp.children, wbxmlElement(pageProvision, tagRemoteWipe))
+	}
+	return resp
+}
+
+func TestActiveSyncProvisioning(t *testing.T) {
+	server := &activeSyncServer{t: t}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	tester := NewActiveSyncTester(config.WebmailServerConfig{
+		Name: "activesync", Type: "activesync", BaseURL: ts.URL, Username: "user", Password: "secret",
+	})
+	for i := 0; i < 2; i++ {
+		if err := tester.RunSession(context.Background()); err != nil {
+			t.Fatalf("session %d: RunSession() = %v", i, err)
+		}
+	}
+	// The policy key is kept, so only the first session provisions.
+	if server.provisions != 2 {
+		t.Errorf("provision requests = %d, want 2", server.provisions)
+	}
+}
+
+func TestActiveSyncRemoteWipe(t *testing.T) {
+	server := &activeSyncServer{t: t, wipe: true}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	tester := NewActiveSyncTester(config.WebmailServerConfig{
+		Name: "activesync-wipe", Type: "activesync", BaseURL: ts.URL, Username: "user", Password: "secret",
+	})
+	err := tester.RunSession(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "remote wipe") {
+		t.Fatalf("RunSession() = %v, want a remote wipe error", err)
+	}
+	// The wipe request is never acknowledged.
+	if server.provisions != 1 {
+		t.Errorf("provision requests = %d, want 1", server.provisions)
+	}
+}
+
+func TestActiveSyncNoChanges(t *testing.T) {
+	ts := httptest.NewServer(&activeSyncServer{t: t, noChanges: true})
+	defer ts.Close()
+
+	tester := NewActiveSyncTester(config.WebmailServerConfig{
+		Name: "activesync-empty", Type: "activesync", BaseURL: ts.URL, Username: "user", Password: "secret",
+	})
+	if err := tester.RunSession(context.Background()); err != nil {
+		t.Fatalf("RunSession() = %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package webmailtester
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/errclass"
+)
+
+const ewsEnvelope = `<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"
+  xmlns:t="http://schemas.microsoft.com/exchange/services/2006/types"
+  xmlns:m="http://schemas.microsoft.com/exchange/services/2006/messages">
+  <soap:Header><t:RequestServerVersion Version="Exchange2013"/></soap:Header>
+  <soap:Body>%s</soap:Body>
+</soap:Envelope>`
+
+const ewsGetInbox = `<m:GetFolder>
+  <m:FolderShape><t:BaseShape>IdOnly</t:BaseShape></m:FolderShape>
+  <m:FolderIds><t:DistinguishedFolderId Id="inbox"/></m:FolderIds>
+</m:GetFolder>`
+
+const ewsFindItems = `<m:FindItem Traversal="Shallow">
+  <m:ItemShape><t:BaseShape>IdOnly</t:BaseShape></m:ItemShape>
+  <m:IndexedPageItemView MaxEntriesReturned="10" Offset="0" BasePoint="Beginning"/>
+  <m:ParentFolderIds><t:DistinguishedFolderId Id="inbox"/></m:ParentFolderIds>
+</m:FindItem>`
+
+const ewsGetItem = `<m:GetItem>
+  <m:ItemShape><t:BaseShape>Default</t:BaseShape></m:ItemShape>
+  <m:ItemIds><t:ItemId Id="%s"/></m:ItemIds>
+</m:GetItem>`
+
+// EWSTester probes Exchange Web Services: GetFolder on the inbox as login, FindItem as
+// listing and GetItem on the first message as message load.
+type EWSTester struct {
+	cfg    config.WebmailServerConfig
+	client *http.Client
+	itemID string
+}
+
+func (e *EWSTester) GetName() string {
+	return e.cfg.Name
+}
+
+func NewEWSTester(cfg config.WebmailServerConfig) WebmailTester {
+	return &EWSTester{
+		cfg:    cfg,
+		client: newExchangeClient(cfg),
+	}
+}
+
+func init() {
+	Register("ews", NewEWSTester)
+}
+
+func (e *EWSTester) RunSession(ctx context.Context) error {
+	defer func() { e.itemID = "" }()
+
+	if err := traced(ctx, "login", e.login); err != nil {
+		webmailErrors.WithLabelValues(e.cfg.Name, "login").Inc()
+		return fmt.Errorf("login failed: %w", err)
+	}
+
+	if err := traced(ctx, "list", e.testListing); err != nil {
+		webmailErrors.WithLabelValues(e.cfg.Name, "listing").Inc()
+		return fmt.Errorf("listing test failed: %w", err)
+	}
+
+	if err := traced(ctx, "preview", e.testMessageLoad); err != nil {
+		webmailErrors.WithLabelValues(e.cfg.Name, "loading").Inc()
+		return fmt.Errorf("message load test failed: %w", err)
+	}
+
+	return nil
+}
+
+func (e *EWSTester) login(ctx context.Context) error {
+	start := time.Now()
+	if _, err := e.call(ctx, ewsGetInbox); err != nil {
+		handleFailure(ctx, e.cfg.Name, "login", err)
+		return err
+	}
+	observe(ctx, webmailLoginTime, e.cfg.Name, "login", time.Since(start))
+	return nil
+}
+
+func (e *EWSTester) testListing(ctx context.Context) error {
+	start := time.Now()
+	ids, err := e.call(ctx, ewsFindItems)
+	if err != nil {
+		handleFailure(ctx, e.cfg.Name, "listing", err)
+		return err
+	}
+	if len(ids) > 0 {
+		e.itemID = ids[0]
+	}
+	observe(ctx, webmailFirstPageTime, e.cfg.Name, "listing", time.Since(start))
+	return nil
+}
+
+func (e *EWSTester) testMessageLoad(ctx context.Context) error {
+	if e.itemID == "" {
+		webmailMessageLoadTime.WithLabelValues(e.cfg.Name).Set(0)
+		return nil
+	}
+
+	start := time.Now()
+	var id strings.Builder
+	xml.EscapeText(&id, []byte(e.itemID))
+	if _, err := e.call(ctx, fmt.Sprintf(ewsGetItem, id.String())); err != nil {
+		handleFailure(ctx, e.cfg.Name, "loading", err)
+		return err
+	}
+	observe(ctx, webmailMessageLoadTime, e.cfg.Name, "loading", time.Since(start))
+	return nil
+}
+
+// call posts a SOAP request and returns the item IDs found in the response.
+func (e *EWSTester) call(ctx context.Context, body string) ([]string, error) {
+	url := strings.TrimSuffix(e.cfg.BaseURL, "/") + "/EWS/Exchange.asmx"
+	resp, err := exchangeRequest(ctx, e.client, e.cfg, "POST", url, "text/xml; charset=utf-8",
+		[]byte(fmt.Sprintf(ewsEnvelope, body)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return parseEWSResponse(resp.Body)
+}
+
+// parseEWSResponse collects ItemId attributes and fails on SOAP faults or any response
+// message whose ResponseClass is not Success. An ErrorAccessDenied response code is an
+// auth failure.
+func parseEWSResponse(r io.Reader) ([]string, error) {
+	decoder := xml.NewDecoder(r)
+	var ids []string
+	var failure, code, text string
+	inText, inCode := false, false
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errclass.New(errclass.UnexpectedContent, fmt.Errorf("failed to parse response: %w", err))
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "ResponseClass" && attr.Value != "Success" && failure == "" {
+					failure = attr.Value
+				}
+				if t.Name.Local == "ItemId" && attr.Name.Local == "Id" {
+					ids = append(ids, attr.Value)
+				}
+			}
+			if t.Name.Local == "Fault" && failure == "" {
+				failure = "SOAP fault"
+			}
+			inText = t.Name.Local == "MessageText" || t.Name.Local == "faultstring"
+			inCode = t.Name.Local == "ResponseCode"
+		case xml.CharData:
+			if inText && text == "" {
+				text = strings.TrimSpace(string(t))
+			}
+			if inCode && failure != "" && code == "" {
+				code = strings.TrimSpace(string(t))
+			}
+		case xml.EndElement:
+			inText, inCode = false, false
+		}
+	}
+
+	if failure != "" {
+		if code != "" {
+			failure += " " + code
+		}
+		err := fmt.Errorf("ews returned %s: %s", failure, text)
+		if code == "ErrorAccessDenied" {
+			return nil, errclass.New(errclass.Auth, err)
+		}
+		return nil, err
+	}
+	return ids, nil
+}
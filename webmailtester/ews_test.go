@@ -0,0 +1,143 @@
+package webmailtester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/errclass"
+)
+
+const ewsResponseEnvelope = `<?xml version="1.0" encoding="utf-8"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Body xmlns:m="http://schemas.microsoft.com/exchange/services/2006/messages"
+    xmlns:t="http://schemas.microsoft.com/exchange/services/2006/types">%s</s:Body>
+</s:Envelope>`
+
+const ewsGetFolderSuccess = `<m:GetFolderResponse><m:ResponseMessages>
+  <m:GetFolderResponseMessage ResponseClass="Success"><m:ResponseCode>NoError</m:ResponseCode>
+    <m:Folders><t:Folder><t:FolderId Id="inbox-id"/></t:Folder></m:Folders>
+  </m:GetFolderResponseMessage>
+</m:ResponseMessages></m:GetFolderResponse>`
+
+const ewsFindItemSuccess = `<m:FindItemResponse><m:ResponseMessages>
+  <m:FindItemResponseMessage ResponseClass="Success"><m:ResponseCode>NoError</m:ResponseCode>
+    <m:RootFolder TotalItemsInView="2" IncludesLastItemInRange="true"><t:Items>
+      <t:Message><t:ItemId Id="AAMk1" ChangeKey="CQA1"/></t:Message>
+      <t:Message><t:ItemId Id="AAMk2" ChangeKey="CQA2"/></t:Message>
+    </t:Items></m:RootFolder>
+  </m:FindItemResponseMessage>
+</m:ResponseMessages></m:FindItemResponse>`
+
+const ewsFindItemAccessDenied = `<m:FindItemResponse><m:ResponseMessages>
+  <m:FindItemResponseMessage ResponseClass="Error">
+    <m:MessageText>Access is denied. Check credentials and try again.</m:MessageText>
+    <m:ResponseCode>ErrorAccessDenied</m:ResponseCode>
+    <m:DescriptiveLinkKey>0</m:DescriptiveLinkKey>
+  </m:FindItemResponseMessage>
+</m:ResponseMessages></m:FindItemResponse>`
+
+const ewsGetItemSuccess = `<m:GetItemResponse><m:ResponseMessages>
+  <m:GetItemResponseMessage ResponseClass="Success"><m:ResponseCode>NoError</m:ResponseCode>
+    <m:Items><t:Message><t:ItemId Id="AAMk1" ChangeKey="CQA1"/><t:Subject>Hello</t:Subject></t:Message></m:Items>
+  </m:GetItemResponseMessage>
+</m:ResponseMessages></m:GetItemResponse>`
+
+// ewsServer answers the three EWS operations of a session with canned SOAP responses.
+type ewsServer struct {
+	t        *testing.T
+	findItem string
+	itemIDs  []string
+}
+
+func (s *ewsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/EWS/Exchange.asmx" {
+		http.NotFound(w, r)
+		return
+	}
+	if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	data, _ := io.ReadAll(r.Body)
+	body := string(data)
+
+	var resp string
+	switch {
+	case strings.Contains(body, "<m:GetFolder>"):
+		resp = ewsGetFolderSuccess
+	case strings.Contains(body, "<m:FindItem "):
+		resp = s.findItem
+	case strings.Contains(body, "<m:GetItem>"):
+		start := strings.Index(body, `<t:ItemId Id="`) + len(`<t:ItemId Id="`)
+		s.itemIDs = append(s.itemIDs, body[start:start+strings.Index(body[start:], `"`)])
+		resp = ewsGetItemSuccess
+	default:
+		s.t.Errorf("unexpected request: %s", body)
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	fmt.Fprintf(w, ewsResponseEnvelope, resp)
+}
+
+func TestEWSSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		findItem  string
+		wantErr   bool
+		wantClass string
+		wantItems []string
+	}{
+		{"find item success", ewsFindItemSuccess, false, "", []string{"AAMk1"}},
+		{"access denied", ewsFindItemAccessDenied, true, errclass.Auth, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &ewsServer{t: t, findItem: tt.findItem}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			tester := NewEWSTester(config.WebmailServerConfig{
+				Name: "ews-" + tt.name, Type: "ews", BaseURL: ts.URL + "/", Username: "user", Password: "secret",
+			})
+			err := tester.RunSession(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunSession() = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "ErrorAccessDenied") {
+					t.Errorf("RunSession() = %v, want the response code", err)
+				}
+				if got := errclass.Classify(err); got != tt.wantClass {
+					t.Errorf("Classify() = %s, want %s", got, tt.wantClass)
+				}
+			}
+			if fmt.Sprint(server.itemIDs) != fmt.Sprint(tt.wantItems) {
+				t.Errorf("GetItem IDs = %v, want %v", server.itemIDs, tt.wantItems)
+			}
+		})
+	}
+}
+
+func TestParseEWSResponse(t *testing.T) {
+	ids, err := parseEWSResponse(strings.NewReader(fmt.Sprintf(ewsResponseEnvelope, ewsFindItemSuccess)))
+	if err != nil || fmt.Sprint(ids) != "[AAMk1 AAMk2]" {
+		t.Errorf("parseEWSResponse(FindItem) = %v, %v, want [AAMk1 AAMk2]", ids, err)
+	}
+
+	_, err = parseEWSResponse(strings.NewReader(fmt.Sprintf(ewsResponseEnvelope, ewsFindItemAccessDenied)))
+	if want := "ews returned Error ErrorAccessDenied: Access is denied. Check credentials and try again."; err == nil || err.Error() != want {
+		t.Errorf("parseEWSResponse(ErrorAccessDenied) = %v, want %q", err, want)
+	}
+	var classified *errclass.Error
+	if !errors.As(err, &classified) || classified.Reason != errclass.Auth {
+		t.Errorf("parseEWSResponse(ErrorAccessDenied) reason = %v, want %s", err, errclass.Auth)
+	}
+}
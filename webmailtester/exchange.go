@@ -0,0 +1,63 @@
+package webmailtester
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/Azure/go-ntlmssp"
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/errclass"
+	"github.com/dniminenn/mailmetrix/tracing"
+	"github.com/dniminenn/mailmetrix/transcript"
+)
+
+// newExchangeClient returns a client for the Exchange testers. With NTLM the negotiator
+// turns the Basic credentials set on each request into an NTLM handshake.
+func newExchangeClient(cfg config.WebmailServerConfig) *http.Client {
+	var transport http.RoundTripper = tracing.Transport{RoundTripper: transcriptTransport{http.DefaultTransport.(*http.Transport).Clone()}, Tracer: tracer}
+	if cfg.Auth == "ntlm" {
+		transport = ntlmssp.Negotiator{RoundTripper: transport}
+	}
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+	}
+}
+
+// exchangeRequest sends an authenticated request with the dial and TTFB trace attached.
+func exchangeRequest(ctx context.Context, client *http.Client, cfg config.WebmailServerConfig,
+	method, url, contentType string, body []byte, header http.Header) (*http.Response, error) {
+	start := time.Now()
+	transcript.FromContext(ctx).Mask(cfg.Password)
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, newClientTrace(ctx, cfg.Name, start)),
+		method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth(cfg.Username, cfg.Password)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", cfg.UserAgent)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &errclass.HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return resp, nil
+}
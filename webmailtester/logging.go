@@ -0,0 +1,27 @@
+package webmailtester
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/logging"
+)
+
+var logger = logging.New("webmail")
+
+type loggerKey struct{}
+
+// withLogger returns a context carrying the logger with the attributes of the server.
+func withLogger(ctx context.Context, cfg config.WebmailServerConfig) context.Context {
+	l := logger.With("server", cfg.Name, "type", "webmail", "webmail_type", cfg.Type)
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// loggerFrom returns the logger of the session, or one naming only the server.
+func loggerFrom(ctx context.Context, server string) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return logger.With("server", server, "type", "webmail")
+}
@@ -5,6 +5,30 @@ import (
 )
 
 var (
+	webmailDNSLookupTime = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "webmail_dns_lookup_seconds",
+			Help:      "Time to resolve the webmail hostname",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server"},
+	)
+	webmailConnectTime = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "webmail_tcp_connect_seconds",
+			Help:      "Time to establish a TCP connection to each webmail address",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server", "address"},
+	)
+	webmailTLSHandshakeTime = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:      "webmail_tls_handshake_seconds",
+			Help:      "Time to complete the TLS handshake with webmail",
+			Namespace: "mailmetrix",
+		},
+		[]string{"server"},
+	)
 	webmailTTFB = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name:      "webmail_ttfb_seconds",
@@ -48,20 +72,24 @@ var (
 	webmailFailures = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name:      "webmail_failures_total",
-			Help:      "Total number of webmail operation failures",
+			Help:      "Total number of webmail operation failures by reason",
 			Namespace: "mailmetrix",
 		},
-		[]string{"server", "operation"},
+		[]string{"server", "operation", "reason"},
 	)
 )
 
 func init() {
 	metrics := []prometheus.Collector{
+		webmailDNSLookupTime,
+		webmailConnectTime,
+		webmailTLSHandshakeTime,
 		webmailTTFB,
 		webmailLoginTime,
 		webmailFirstPageTime,
 		webmailMessageLoadTime,
 		webmailErrors,
+		webmailFailures,
 	}
 
 	for _, m := range metrics {
@@ -11,6 +11,9 @@ import (
 	"time"
 
 	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/errclass"
+	"github.com/dniminenn/mailmetrix/tracing"
+	"github.com/dniminenn/mailmetrix/transcript"
 )
 
 type RoundcubeTester struct {
@@ -29,7 +32,8 @@ func NewRoundcubeTester(cfg config.WebmailServerConfig) WebmailTester {
 	return &RoundcubeTester{
 		cfg: cfg,
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: tracing.Transport{RoundTripper: transcriptTransport{http.DefaultTransport}, Tracer: tracer},
 		},
 	}
 }
@@ -42,7 +46,7 @@ func (r *RoundcubeTester) RunSession(ctx context.Context) error {
 	errChan := make(chan error, 1)
 
 	go func() {
-		if err := r.login(); err != nil {
+		if err := traced(ctx, "login", r.login); err != nil {
 			errChan <- fmt.Errorf("login failed: %w", err)
 			webmailErrors.WithLabelValues(r.cfg.Name, "login").Inc()
 			return
@@ -53,13 +57,13 @@ func (r *RoundcubeTester) RunSession(ctx context.Context) error {
 			r.authToken = ""
 		}()
 
-		if err := r.testListing(); err != nil {
+		if err := traced(ctx, "list", r.testListing); err != nil {
 			errChan <- fmt.Errorf("listing test failed: %w", err)
 			webmailErrors.WithLabelValues(r.cfg.Name, "listing").Inc()
 			return
 		}
 
-		if err := r.testMessageLoad(); err != nil {
+		if err := traced(ctx, "preview", r.testMessageLoad); err != nil {
 			errChan <- fmt.Errorf("message load test failed: %w", err)
 			webmailErrors.WithLabelValues(r.cfg.Name, "loading").Inc()
 			return
@@ -78,132 +82,108 @@ func (r *RoundcubeTester) RunSession(ctx context.Context) error {
 	}
 }
 
-func (r *RoundcubeTester) login() error {
+func (r *RoundcubeTester) login(ctx context.Context) error {
 	start := time.Now()
+	transcript.FromContext(ctx).Mask(r.cfg.Password)
 
 	loginURL := fmt.Sprintf("%s/?_task=login", r.cfg.BaseURL)
 	formData := fmt.Sprintf("_task=login&_action=login&_user=%s&_pass=%s", r.cfg.Username, r.cfg.Password)
 
-	// TTFB Tracking
-	var ttfb time.Duration
-	trace := &httptrace.ClientTrace{
-		GotFirstResponseByte: func() {
-			ttfb = time.Since(start)
-			webmailTTFB.WithLabelValues(r.cfg.Name).Set(ttfb.Seconds())
-		},
-	}
-
 	req, err := http.NewRequest("POST", loginURL, strings.NewReader(formData))
 	if err != nil {
-		handleFailure(r.cfg.Name, "login", err)
+		handleFailure(ctx, r.cfg.Name, "login", err)
 		return fmt.Errorf("failed to create login request: %w", err)
 	}
-	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	req = req.WithContext(httptrace.WithClientTrace(ctx, newClientTrace(ctx, r.cfg.Name, start)))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	resp, err := r.client.Do(req)
 	if err != nil {
-		handleFailure(r.cfg.Name, "login", err)
+		handleFailure(ctx, r.cfg.Name, "login", err)
 		return fmt.Errorf("login request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		handleFailure(r.cfg.Name, "login", fmt.Errorf("status code: %d, body: %s", resp.StatusCode, string(body)))
+		handleFailure(ctx, r.cfg.Name, "login", &errclass.HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)})
 		return fmt.Errorf("login failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
 	r.sessionID = extractSessionID(resp.Header)
 	r.authToken = extractAuthToken(resp.Body)
 	if r.sessionID == "" || r.authToken == "" {
-		err := fmt.Errorf("failed to retrieve session ID or auth token")
-		handleFailure(r.cfg.Name, "login", err)
+		err := errclass.Errorf(errclass.UnexpectedContent, "failed to retrieve session ID or auth token")
+		handleFailure(ctx, r.cfg.Name, "login", err)
 		return err
 	}
 
 	loginDuration := time.Since(start)
-	webmailLoginTime.WithLabelValues(r.cfg.Name).Set(loginDuration.Seconds())
+	observe(ctx, webmailLoginTime, r.cfg.Name, "login", loginDuration)
 	return nil
 }
 
-func (r *RoundcubeTester) testListing() error {
+func (r *RoundcubeTester) testListing(ctx context.Context) error {
 	start := time.Now()
 	listURL := fmt.Sprintf("%s/?_task=mail&_action=list", r.cfg.BaseURL)
 
 	req, err := http.NewRequest("GET", listURL, nil)
 	if err != nil {
-		handleFailure(r.cfg.Name, "listing", err)
+		handleFailure(ctx, r.cfg.Name, "listing", err)
 		return fmt.Errorf("failed to create list request: %w", err)
 	}
 
 	req.Header.Set("Cookie", r.sessionID)
 	req.Header.Set("X-Roundcube-Auth", r.authToken)
-
-	var ttfb time.Duration
-	trace := &httptrace.ClientTrace{
-		GotFirstResponseByte: func() {
-			ttfb = time.Since(start)
-			webmailTTFB.WithLabelValues(r.cfg.Name).Set(ttfb.Seconds())
-		},
-	}
-	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	req = req.WithContext(httptrace.WithClientTrace(ctx, newClientTrace(ctx, r.cfg.Name, start)))
 
 	resp, err := r.client.Do(req)
 	if err != nil {
-		handleFailure(r.cfg.Name, "listing", err)
+		handleFailure(ctx, r.cfg.Name, "listing", err)
 		return fmt.Errorf("list request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		handleFailure(r.cfg.Name, "listing", fmt.Errorf("status code: %d, body: %s", resp.StatusCode, string(body)))
+		handleFailure(ctx, r.cfg.Name, "listing", &errclass.HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)})
 		return fmt.Errorf("listing failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
 	listDuration := time.Since(start)
-	webmailFirstPageTime.WithLabelValues(r.cfg.Name).Set(listDuration.Seconds())
+	observe(ctx, webmailFirstPageTime, r.cfg.Name, "listing", listDuration)
 	return nil
 }
 
-func (r *RoundcubeTester) testMessageLoad() error {
+func (r *RoundcubeTester) testMessageLoad(ctx context.Context) error {
 	start := time.Now()
 	loadURL := fmt.Sprintf("%s/?_task=mail&_action=preview&_uid=1", r.cfg.BaseURL)
 
 	req, err := http.NewRequest("GET", loadURL, nil)
 	if err != nil {
-		handleFailure(r.cfg.Name, "loading", err)
+		handleFailure(ctx, r.cfg.Name, "loading", err)
 		return fmt.Errorf("failed to create message load request: %w", err)
 	}
 
 	req.Header.Set("Cookie", r.sessionID)
 	req.Header.Set("X-Roundcube-Auth", r.authToken)
-
-	var ttfb time.Duration
-	trace := &httptrace.ClientTrace{
-		GotFirstResponseByte: func() {
-			ttfb = time.Since(start)
-			webmailTTFB.WithLabelValues(r.cfg.Name).Set(ttfb.Seconds())
-		},
-	}
-	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	req = req.WithContext(httptrace.WithClientTrace(ctx, newClientTrace(ctx, r.cfg.Name, start)))
 
 	resp, err := r.client.Do(req)
 	if err != nil {
-		handleFailure(r.cfg.Name, "loading", err)
+		handleFailure(ctx, r.cfg.Name, "loading", err)
 		return fmt.Errorf("message load request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		handleFailure(r.cfg.Name, "loading", fmt.Errorf("status code: %d, body: %s", resp.StatusCode, string(body)))
+		handleFailure(ctx, r.cfg.Name, "loading", &errclass.HTTPStatusError{StatusCode: resp.StatusCode, Body: string(body)})
 		return fmt.Errorf("message load failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
 	loadDuration := time.Since(start)
-	webmailMessageLoadTime.WithLabelValues(r.cfg.Name).Set(loadDuration.Seconds())
+	observe(ctx, webmailMessageLoadTime, r.cfg.Name, "loading", loadDuration)
 	return nil
 }
 
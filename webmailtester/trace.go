@@ -0,0 +1,77 @@
+package webmailtester
+
+import (
+	"context"
+	"crypto/tls"
+	"math"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/dniminenn/mailmetrix/results"
+)
+
+// newClientTrace returns a trace recording DNS lookup, per-address TCP connect, TLS handshake
+// and time to first byte for a request started at start. The dial hooks only fire when the
+// transport opens a new connection, so reused keep-alive connections leave those metrics untouched.
+// The negotiated TLS parameters are recorded in the session of ctx.
+func newClientTrace(ctx context.Context, server string, start time.Time) *httptrace.ClientTrace {
+	session := results.FromContext(ctx)
+	var mu sync.Mutex
+	var dnsStart, tlsStart time.Time
+	connectStart := make(map[string]time.Time)
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsStart = time.Now()
+			mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err != nil {
+				webmailDNSLookupTime.WithLabelValues(server).Set(math.NaN())
+				return
+			}
+			mu.Lock()
+			webmailDNSLookupTime.WithLabelValues(server).Set(time.Since(dnsStart).Seconds())
+			mu.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			connectStart[addr] = time.Now()
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			ip := addr
+			if host, _, splitErr := net.SplitHostPort(addr); splitErr == nil {
+				ip = host
+			}
+			if err != nil {
+				webmailConnectTime.WithLabelValues(server, ip).Set(math.NaN())
+				return
+			}
+			mu.Lock()
+			webmailConnectTime.WithLabelValues(server, ip).Set(time.Since(connectStart[addr]).Seconds())
+			mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsStart = time.Now()
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				webmailTLSHandshakeTime.WithLabelValues(server).Set(math.NaN())
+				return
+			}
+			session.SetTLS(state)
+			mu.Lock()
+			webmailTLSHandshakeTime.WithLabelValues(server).Set(time.Since(tlsStart).Seconds())
+			mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			webmailTTFB.WithLabelValues(server).Set(time.Since(start).Seconds())
+		},
+	}
+}
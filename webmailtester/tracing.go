@@ -0,0 +1,40 @@
+package webmailtester
+
+import (
+	"context"
+
+	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/dniminenn/mailmetrix/webmailtester")
+
+// tracedTester runs every session of a tester in its own trace.
+type tracedTester struct {
+	WebmailTester
+	cfg config.WebmailServerConfig
+}
+
+func (t tracedTester) RunSession(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "webmail.session", trace.WithAttributes(
+		attribute.String("mailmetrix.server", t.cfg.Name),
+		attribute.String("webmail.type", t.cfg.Type),
+		semconv.URLFull(t.cfg.BaseURL),
+	))
+	defer span.End()
+
+	err := t.WebmailTester.RunSession(withLogger(ctx, t.cfg))
+	if err != nil {
+		tracing.FailSession(ctx, span, err)
+	}
+	return err
+}
+
+// traced runs one operation of a session in its own span.
+func traced(ctx context.Context, name string, operation func(context.Context) error) error {
+	return tracing.Operation(ctx, tracer, "webmail."+name, operation)
+}
@@ -0,0 +1,64 @@
+package webmailtester
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"unicode/utf8"
+
+	"github.com/dniminenn/mailmetrix/transcript"
+)
+
+// maxTranscriptBody bounds how much of each request and response body is recorded.
+const maxTranscriptBody = 8 << 10
+
+// transcriptTransport records every request and response in the transcript of the
+// request's context, if any. It sits below the NTLM negotiator so each leg of the
+// handshake is recorded.
+type transcriptTransport struct {
+	http.RoundTripper
+}
+
+func (t transcriptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr := transcript.FromContext(req.Context())
+	if tr == nil {
+		return t.RoundTripper.RoundTrip(req)
+	}
+
+	if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+		tr.Append("> ", printable(dump))
+	}
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		tr.Append("! ", []byte(err.Error()+"\n"))
+		return nil, err
+	}
+	if dump, err := httputil.DumpResponse(resp, true); err == nil {
+		tr.Append("< ", printable(dump))
+	}
+	return resp, nil
+}
+
+// printable returns a dumped message with its body truncated, or replaced by its size
+// when it is binary, such as WBXML.
+func printable(dump []byte) []byte {
+	header, body, ok := bytes.Cut(dump, []byte("\r\n\r\n"))
+	if !ok || len(body) == 0 {
+		return dump
+	}
+	var out bytes.Buffer
+	out.Write(header)
+	out.WriteString("\r\n\r\n")
+	switch {
+	case !utf8.Valid(body) || bytes.IndexByte(body, 0) >= 0:
+		fmt.Fprintf(&out, "[%d bytes of binary body]", len(body))
+	case len(body) > maxTranscriptBody:
+		out.Write(body[:maxTranscriptBody])
+		fmt.Fprintf(&out, "\n[%d more bytes]", len(body)-maxTranscriptBody)
+	default:
+		out.Write(body)
+	}
+	out.WriteString("\n")
+	return out.Bytes()
+}
@@ -0,0 +1,224 @@
+package webmailtester
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// WBXML global tokens used by Exchange ActiveSync.
+const (
+	wbxmlSwitchPage = 0x00
+	wbxmlEnd        = 0x01
+	wbxmlStrI       = 0x03
+	wbxmlOpaque     = 0xC3
+	wbxmlHasContent = 0x40
+)
+
+// ActiveSync code pages and the tags this package uses from them.
+const (
+	pageAirSync         = 0
+	tagSync             = 0x05
+	tagSyncKey          = 0x0B
+	tagStatus           = 0x0E
+	tagCollection       = 0x0F
+	tagCollectionID     = 0x12
+	tagGetChanges       = 0x13
+	tagWindowSize       = 0x15
+	tagCollections      = 0x1C
+	pageFolderHierarchy = 7
+	tagFolderServerID   = 0x08
+	tagFolderType       = 0x0A
+	tagFolderStatus     = 0x0C
+	tagFolderAdd        = 0x0F
+	tagFolderSyncKey    = 0x12
+	tagFolderSync       = 0x16
+	pageProvision       = 14
+	tagProvision        = 0x05
+	tagPolicies         = 0x06
+	tagPolicy           = 0x07
+	tagPolicyType       = 0x08
+	tagPolicyKey        = 0x09
+	tagProvisionStatus  = 0x0B
+	tagRemoteWipe       = 0x0C
+)
+
+// wbxmlNode is an element of an ActiveSync WBXML document.
+type wbxmlNode struct {
+	page     byte
+	tag      byte
+	text     string
+	children []*wbxmlNode
+}
+
+func wbxmlElement(page, tag byte, children ...*wbxmlNode) *wbxmlNode {
+	return &wbxmlNode{page: page, tag: tag, children: children}
+}
+
+func wbxmlText(page, tag byte, text string) *wbxmlNode {
+	return &wbxmlNode{page: page, tag: tag, text: text}
+}
+
+// encode serializes the document with WBXML 1.3, unknown public ID and UTF-8.
+func (n *wbxmlNode) encode() []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0x03, 0x01, 0x6A, 0x00})
+	page := byte(0)
+	n.write(&buf, &page)
+	return buf.Bytes()
+}
+
+func (n *wbxmlNode) write(buf *bytes.Buffer, page *byte) {
+	if n.page != *page {
+		buf.Write([]byte{wbxmlSwitchPage, n.page})
+		*page = n.page
+	}
+	if n.text == "" && len(n.children) == 0 {
+		buf.WriteByte(n.tag)
+		return
+	}
+
+	buf.WriteByte(n.tag | wbxmlHasContent)
+	if n.text != "" {
+		buf.WriteByte(wbxmlStrI)
+		buf.WriteString(n.text)
+		buf.WriteByte(0)
+	}
+	for _, child := range n.children {
+		child.write(buf, page)
+	}
+	buf.WriteByte(wbxmlEnd)
+}
+
+// find returns the first descendant (or n itself) with the given page and tag.
+func (n *wbxmlNode) find(page, tag byte) *wbxmlNode {
+	if n.page == page && n.tag == tag {
+		return n
+	}
+	for _, child := range n.children {
+		if found := child.find(page, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll returns every descendant with the given page and tag.
+func (n *wbxmlNode) findAll(page, tag byte) []*wbxmlNode {
+	var found []*wbxmlNode
+	if n.page == page && n.tag == tag {
+		found = append(found, n)
+	}
+	for _, child := range n.children {
+		found = append(found, child.findAll(page, tag)...)
+	}
+	return found
+}
+
+// childText returns the text of the first descendant with the given page and tag.
+func (n *wbxmlNode) childText(page, tag byte) string {
+	if found := n.find(page, tag); found != nil {
+		return found.text
+	}
+	return ""
+}
+
+func readMultiByteUint(r *bufio.Reader) (uint32, error) {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<7 | uint32(b&0x7F)
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("multi-byte integer too long")
+}
+
+// decodeWBXML parses an ActiveSync response. Attributes and string table references are
+// not used by ActiveSync and are rejected.
+func decodeWBXML(data []byte) (*wbxmlNode, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	if _, err := r.ReadByte(); err != nil {
+		return nil, fmt.Errorf("empty wbxml document")
+	}
+	publicID, err := readMultiByteUint(r)
+	if err != nil {
+		return nil, err
+	}
+	if publicID == 0 {
+		if _, err := readMultiByteUint(r); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := readMultiByteUint(r); err != nil {
+		return nil, err
+	}
+	tableLen, err := readMultiByteUint(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Discard(int(tableLen)); err != nil {
+		return nil, err
+	}
+
+	page := byte(0)
+	root := &wbxmlNode{}
+	stack := []*wbxmlNode{root}
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		current := stack[len(stack)-1]
+
+		switch b {
+		case wbxmlSwitchPage:
+			if page, err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+		case wbxmlEnd:
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("unbalanced end token")
+			}
+			stack = stack[:len(stack)-1]
+		case wbxmlStrI:
+			s, err := r.ReadString(0)
+			if err != nil {
+				return nil, err
+			}
+			current.text += s[:len(s)-1]
+		case wbxmlOpaque:
+			n, err := readMultiByteUint(r)
+			if err != nil {
+				return nil, err
+			}
+			opaque := make([]byte, n)
+			if _, err := io.ReadFull(r, opaque); err != nil {
+				return nil, err
+			}
+			current.text += string(opaque)
+		default:
+			if b&0x80 != 0 || b&0x3F < 0x05 {
+				return nil, fmt.Errorf("unsupported wbxml token 0x%02x", b)
+			}
+			node := &wbxmlNode{page: page, tag: b & 0x3F}
+			current.children = append(current.children, node)
+			if b&wbxmlHasContent != 0 {
+				stack = append(stack, node)
+			}
+		}
+	}
+
+	if len(root.children) == 0 {
+		return nil, fmt.Errorf("empty wbxml document")
+	}
+	return root.children[0], nil
+}
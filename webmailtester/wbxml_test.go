@@ -0,0 +1,102 @@
+package webmailtester
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestWBXMLRoundTrip(t *testing.T) {
+	docs := map[string]*wbxmlNode{
+		"empty element": wbxmlElement(pageFolderHierarchy, tagFolderSync),
+		"folder sync": wbxmlElement(pageFolderHierarchy, tagFolderSync,
+			wbxmlText(pageFolderHierarchy, tagFolderSyncKey, "0")),
+		"sync with page switches": wbxmlElement(pageAirSync, tagSync,
+			wbxmlElement(pageAirSync, tagCollections,
+				wbxmlElement(pageAirSync, tagCollection,
+					wbxmlText(pageAirSync, tagSyncKey, "1234567890"),
+					wbxmlText(pageAirSync, tagCollectionID, "5"),
+					wbxmlElement(pageAirSync, tagGetChanges),
+					wbxmlText(pageAirSync, tagWindowSize, "10")))),
+		"provision": wbxmlElement(pageProvision, tagProvision,
+			wbxmlElement(pageProvision, tagPolicies,
+				wbxmlElement(pageProvision, tagPolicy,
+					wbxmlText(pageProvision, tagPolicyType, "MS-EAS-Provisioning-WBXML"),
+					wbxmlText(pageProvision, tagPolicyKey, "1307199584"),
+					wbxmlText(pageProvision, tagProvisionStatus, "1")))),
+		"nested pages": wbxmlElement(pageProvision, tagProvision,
+			wbxmlElement(pageAirSync, tagCollections,
+				wbxmlText(pageFolderHierarchy, tagFolderServerID, "Ünïcödé ✓")),
+			wbxmlText(pageProvision, tagProvisionStatus, "1")),
+	}
+	for name, doc := range docs {
+		t.Run(name, func(t *testing.T) {
+			decoded, err := decodeWBXML(doc.encode())
+			if err != nil {
+				t.Fatalf("decodeWBXML() = %v", err)
+			}
+			if !reflect.DeepEqual(decoded, doc) {
+				t.Errorf("round trip changed the document:\n got %s\nwant %s", dump(decoded), dump(doc))
+			}
+		})
+	}
+}
+
+func TestEncodeWBXML(t *testing.T) {
+	doc := wbxmlElement(pageFolderHierarchy, tagFolderSync, wbxmlText(pageFolderHierarchy, tagFolderSyncKey, "0"))
+	want := []byte{
+		0x03, 0x01, 0x6A, 0x00, // version 1.3, unknown public ID, UTF-8, no string table
+		0x00, 0x07, // switch to FolderHierarchy
+		0x56,            // FolderSync with content
+		0x52,            // SyncKey with content
+		0x03, '0', 0x00, // inline string
+		0x01, // end SyncKey
+		0x01, // end FolderSync
+	}
+	if got := doc.encode(); !bytes.Equal(got, want) {
+		t.Errorf("encode() = % x, want % x", got, want)
+	}
+}
+
+func TestDecodeWBXML(t *testing.T) {
+	// A response with a public ID given as a string table reference, a string table and
+	// opaque data, which the encoder never produces.
+	data := []byte{
+		0x03, 0x00, 0x00, 0x6A, 0x03, 'a', 'b', 0x00, // public ID in the string table, UTF-8
+		0x00, 0x07,
+		0x56,
+		0x4C, 0xC3, 0x01, '1', 0x01, // Status with opaque "1"
+		0x01,
+	}
+	doc, err := decodeWBXML(data)
+	if err != nil {
+		t.Fatalf("decodeWBXML() = %v", err)
+	}
+	if got := doc.childText(pageFolderHierarchy, tagFolderStatus); got != "1" {
+		t.Errorf("status = %q, want 1", got)
+	}
+
+	invalid := map[string][]byte{
+		"empty":           {},
+		"header only":     {0x03, 0x01, 0x6A, 0x00},
+		"unbalanced end":  {0x03, 0x01, 0x6A, 0x00, 0x01},
+		"attributes":      {0x03, 0x01, 0x6A, 0x00, 0x85},
+		"truncated text":  {0x03, 0x01, 0x6A, 0x00, 0x45, 0x03, 'a'},
+		"long multi-byte": {0x03, 0x81, 0x81, 0x81, 0x81, 0x81, 0x01},
+	}
+	for name, data := range invalid {
+		if _, err := decodeWBXML(data); err == nil {
+			t.Errorf("decodeWBXML(%s) succeeded, want error", name)
+		}
+	}
+}
+
+// dump formats a document for failure messages.
+func dump(n *wbxmlNode) string {
+	s := fmt.Sprintf("<%d:%#x>%s", n.page, n.tag, n.text)
+	for _, child := range n.children {
+		s += dump(child)
+	}
+	return s + "</>"
+}
@@ -2,11 +2,17 @@ package webmailtester
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"math"
+	"time"
 
 	"github.com/dniminenn/mailmetrix/config"
+	"github.com/dniminenn/mailmetrix/errclass"
+	"github.com/dniminenn/mailmetrix/results"
+	"github.com/dniminenn/mailmetrix/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type WebmailTester interface {
@@ -25,12 +31,28 @@ func NewWebmailTester(cfg config.WebmailServerConfig) (WebmailTester, error) {
 	if !ok {
 		return nil, fmt.Errorf("no webmail tester found for type: %s", cfg.Type)
 	}
-	return factory(cfg), nil
+	return tracedTester{WebmailTester: factory(cfg), cfg: cfg}, nil
 }
 
-func handleFailure(server, operation string, err error) {
-	log.Printf("[ERROR] %s failed for %s: %v", operation, server, err)
-	webmailFailures.WithLabelValues(server, operation).Inc()
+// observe sets the timing gauge of a successful operation and records it in the session.
+func observe(ctx context.Context, gauge *prometheus.GaugeVec, server, operation string, d time.Duration) {
+	gauge.WithLabelValues(server).Set(d.Seconds())
+	results.FromContext(ctx).Step(operation, d)
+	loggerFrom(ctx, server).Debug("Operation succeeded", "operation", operation, "duration", d)
+}
+
+func handleFailure(ctx context.Context, server, operation string, err error) {
+	reason := errclass.Classify(err)
+	loggerFrom(ctx, server).Error("Operation failed", "operation", operation, "error_class", reason, "error", err)
+	webmailFailures.WithLabelValues(server, operation, reason).Inc()
+
+	tracing.Fail(trace.SpanFromContext(ctx), reason, err)
+	session := results.FromContext(ctx)
+	session.Fail(operation, reason, err)
+	var statusErr *errclass.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		session.Snippet(fmt.Sprintf("HTTP %d: %s", statusErr.StatusCode, statusErr.Body))
+	}
 	resetMetricsForOperation(server, operation)
 }
 